@@ -26,9 +26,20 @@ func (opt DestOption) Format() string {
 	return lecio.GetExt(opt.filename)
 }
 
+// WebtoonOption defines the webtoon mode, which stitches images of an episode
+// into strips and cuts the strips into pages of the device aspect ratio.
+type WebtoonOption struct {
+	enabled        bool
+	maxStripHeight int                     // max height of a strip after images are scaled to the same width
+	filter         *lecimg.SplitTallFilter // cuts strips into pages
+}
+
+const defaultMaxStripHeight = 20000
+
 type FilterOption struct {
-	name   string
-	filter lecimg.Filter
+	name     string
+	filter   lecimg.Filter
+	selector *lecimg.PageSelector
 }
 
 // Config defines configuration
@@ -37,9 +48,13 @@ type Config struct {
 	dest          DestOption
 	width         int
 	height        int
-	quality       int
+	quality       int // jpeg quality of pages in pdf
+	pageQuality   int // jpeg quality of page files
 	showEdgePoint bool
 	maxProcess    int
+	errorPolicy   lecimg.ErrorPolicy
+	report        string
+	webtoon       WebtoonOption
 	filterOptions []FilterOption
 }
 
@@ -59,11 +74,20 @@ func (c *Config) LoadYaml(filename string) {
 	c.width = cfg.UInt("width", -1)
 	c.height = cfg.UInt("height", -1)
 	c.quality = cfg.UInt("quality", 100)
+	c.pageQuality = cfg.UInt("pageQuality", lecimg.DefaultPageQuality)
 	c.showEdgePoint = cfg.UBool("showEdgePoint", false)
 	c.maxProcess = cfg.UInt("maxProcess", runtime.NumCPU())
 	if c.maxProcess <= 0 {
 		c.maxProcess = runtime.NumCPU()
 	}
+	c.errorPolicy, err = lecimg.ParseErrorPolicy(cfg.UString("onError", ""))
+	if err != nil {
+		log.Fatalf("Error : %v : %v\n", filename, err)
+	}
+	c.report = cfg.UString("report", "")
+	if cfg.UBool("webtoon.enabled", false) {
+		c.loadWebtoon(cfg, filename)
+	}
 
 	// Load filters
 	for i := 0; ; i++ {
@@ -76,41 +100,60 @@ func (c *Config) LoadYaml(filename string) {
 			continue
 		}
 
-		c.addFilterOption(name.(string), m["options"].(map[string]interface{}))
+		pages, err := lecimg.PageSelectorExpr(m["pages"])
+		if err != nil {
+			log.Printf("Failed to read filter pages : %v : %v\n", name, err)
+			continue
+		}
+		options, _ := m["options"].(map[string]interface{})
+		c.addFilterOption(name.(string), pages, options)
 	}
 }
 
-func (c *Config) addFilterOption(name string, options map[string]interface{}) {
-	var err error
-	var filter lecimg.Filter
-
-	switch name {
-	case "changeLineSpace":
-		if option, err := lecimg.NewChangeLineSpaceOption(options); err == nil {
-			filter = lecimg.NewChangeLineSpaceFilter(*option)
-		}
-	case "resize":
-		if option, err := lecimg.NewResizeOption(options); err == nil {
-			filter = lecimg.NewResizeFilter(*option)
-		}
-	case "watermark":
-		if option, err := lecimg.NewWatermarkOption(options); err == nil {
-			filter = lecimg.NewWatermarkFilter(*option)
-		}
-	default:
-		log.Printf("Unhandled filter name : %v\n", name)
+func (c *Config) loadWebtoon(cfg *config.Config, filename string) {
+	c.webtoon.maxStripHeight = cfg.UInt("webtoon.maxStripHeight", defaultMaxStripHeight)
+	if c.webtoon.maxStripHeight <= 0 {
+		c.webtoon.maxStripHeight = defaultMaxStripHeight
 	}
 
-	if filter != nil {
-		filterOption := FilterOption{
-			name:   name,
-			filter: filter,
-		}
-		c.filterOptions = append(c.filterOptions, filterOption)
-		fmt.Printf("Filter added : %v\n", name)
+	// gaps of webtoons are white unless a threshold is given
+	options, err := cfg.Map("webtoon.options")
+	if err != nil {
+		options = map[string]interface{}{}
+	}
+	if _, ok := options["threshold"]; !ok {
+		options["threshold"] = 240
+	}
+	option, err := lecimg.NewSplitTallOption(options)
+	if err != nil {
+		log.Fatalf("Error : %v : webtoon.options : %v\n", filename, err)
 	}
+	c.webtoon.filter = lecimg.NewSplitTallFilter(*option)
+	c.webtoon.enabled = true
+}
+
+func (c *Config) addFilterOption(name string, pages string, options map[string]interface{}) {
+	filter, err := lecimg.NewFilter(name, options)
 	if err != nil {
 		log.Printf("Failed to read filter : %v : %v\n", name, err)
+		return
+	}
+	selector, err := lecimg.NewPageSelector(pages)
+	if err != nil {
+		log.Printf("Failed to read filter pages : %v : %v\n", name, err)
+		return
+	}
+
+	filterOption := FilterOption{
+		name:     name,
+		filter:   filter,
+		selector: selector,
+	}
+	c.filterOptions = append(c.filterOptions, filterOption)
+	if selector != nil {
+		fmt.Printf("Filter added : %v (pages: %v)\n", name, selector)
+	} else {
+		fmt.Printf("Filter added : %v\n", name)
 	}
 }
 
@@ -134,13 +177,19 @@ func (c *Config) Print() {
 	log.Printf("size : (%v, %v)\n", c.width, c.height)
 	log.Printf("showEdgePoint : %v\n", c.showEdgePoint)
 	log.Printf("quality : %v%%\n", c.quality)
+	log.Printf("pageQuality : %v%%\n", c.pageQuality)
 	log.Printf("maxProcess : %v\n", c.maxProcess)
+	log.Printf("onError : %v\n", c.errorPolicy)
+	log.Printf("report : %v\n", c.report)
+	if c.webtoon.enabled {
+		log.Printf("webtoon : max strip height %v\n", c.webtoon.maxStripHeight)
+	}
 	fmt.Printf("filters : %v\n", len(c.filterOptions))
 }
 
 // NewConfig creates an instance of Config
 func NewConfig(cfgFilename string, srcDir string, destDir string) *Config {
-	cfg := Config{}
+	cfg := Config{pageQuality: lecimg.DefaultPageQuality}
 
 	if cfgFilename != "" {
 		cfg.LoadYaml(cfgFilename)
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLoadYamlPagesList(t *testing.T) {
+	file, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	yaml := "filters:\n  - name: tone\n    pages: [1, 3-4]\n    options:\n      grayscale: true\n"
+	if _, err := file.WriteString(yaml); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	var c Config
+	c.LoadYaml(file.Name())
+	if len(c.filterOptions) != 1 {
+		t.Fatalf("filter should be loaded. filters=%v", len(c.filterOptions))
+	}
+	selector := c.filterOptions[0].selector
+	for index, expected := range []bool{false, true, false, true, true, false} {
+		if selector.Match("page.jpg", index, 6) != expected {
+			t.Errorf("page %v should be selected : %v. pages=%v", index, expected, selector)
+		}
+	}
+}
@@ -7,7 +7,7 @@ import (
 func testGetMetaData(t *testing.T, filename string, expected MetaData) {
 	metaData := GetMetaData(filename)
 	if metaData != expected {
-		t.Errorf("actual: %s, expected: %s\n", metaData, expected)
+		t.Errorf("actual: %v, expected: %v\n", metaData, expected)
 	}
 
 }
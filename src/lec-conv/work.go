@@ -1,11 +1,13 @@
 package main
 
 import (
+	"image"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"sync"
 
 	"lec/lecimg"
@@ -36,7 +38,7 @@ func collectImages(workChan chan<- IWork,
 	finChan chan<- bool,
 	config *Config,
 	destDir string,
-	filters []lecimg.Filter) {
+	pipeline *lecimg.Pipeline) {
 	defer func() {
 		finChan <- true
 	}()
@@ -47,17 +49,18 @@ func collectImages(workChan chan<- IWork,
 		log.Fatal(err)
 	}
 
+	// works are collected first to run the analysis pass before filtering.
+	var works []FilterWork
 	addWork := func(dir string, filename string, index int, removeSrc bool) {
-		workChan <- FilterWork{
+		works = append(works, FilterWork{
 			srcDir:    dir,
 			filename:  filename,
 			index:     index,
 			destDir:   destDir,
-			width:     config.width,
-			height:    config.height,
-			filters:   filters,
+			quality:   config.pageQuality,
+			pipeline:  pipeline,
 			removeSrc: removeSrc,
-		}
+		})
 	}
 
 	// Add works for the images in the 'dir' directory.
@@ -69,6 +72,7 @@ func collectImages(workChan chan<- IWork,
 		}
 
 		// add works
+		pipeline.SetPageCount(len(files))
 		for i, file := range files {
 			addWork(dir, file.Name(), i, removeSrc)
 		}
@@ -82,14 +86,58 @@ func collectImages(workChan chan<- IWork,
 			os.MkdirAll(destDir, os.ModePerm)
 			extractDir, _ := ioutil.TempDir(destDir, "_temp_")
 
+			// collect extracted images first to know the page count
+			var paths []string
 			callback := func(dir, filename string, index int) {
-				addWork(extractDir, filename, index, true)
+				if lecimg.IsImageFile(filename) {
+					paths = append(paths, filepath.Join(dir, filename))
+				}
 			}
 
 			if err := leczip.Unzip(srcFilename, extractDir, callback); err != nil {
 				log.Fatal(err)
 			}
+
+			// add works sorted by filename
+			sort.Slice(paths, func(i, j int) bool {
+				return filepath.Base(paths[i]) < filepath.Base(paths[j])
+			})
+			pipeline.SetPageCount(len(paths))
+			for i, path := range paths {
+				addWork(filepath.Dir(path), filepath.Base(path), i, true)
+			}
+		}
+	}
+
+	// images of webtoons are stitched into strips which end at page cuts
+	if config.webtoon.enabled {
+		pageRects := func(img image.Image) ([]image.Rectangle, error) {
+			return config.webtoon.filter.PageRects(img, config.width, config.height)
 		}
+		works = groupStrips(works, config.webtoon.maxStripHeight, pageRects, pipeline)
+		pipeline.SetPageCount(len(works))
+	}
+
+	// analysis passes
+	for pipeline.NeedsAnalysis() {
+		analyzeWg := sync.WaitGroup{}
+		for _, work := range works {
+			analyzeWg.Add(1)
+			workChan <- AnalyzeWork{
+				srcDir:   work.srcDir,
+				filename: work.filename,
+				strip:    work.strip,
+				index:    work.index,
+				pipeline: pipeline,
+				wg:       &analyzeWg,
+			}
+		}
+		analyzeWg.Wait()
+		pipeline.EndAnalysis()
+	}
+
+	for _, work := range works {
+		workChan <- work
 	}
 }
 
@@ -162,6 +210,17 @@ func createZip(srcDir string, destDir string, filename string) {
 	log.Printf("Done.")
 }
 
+func writeReport(report *lecimg.Report, filename string) {
+	if filename == "" {
+		return
+	}
+
+	log.Printf("[WRITE] %s", filename)
+	if err := report.Write(filename); err != nil {
+		log.Printf("Error : %v : %v\n", filename, err)
+	}
+}
+
 func startWorks(config *Config) {
 	srcFilename := config.src.filename
 	exists, _ := lecio.Exists(srcFilename)
@@ -178,11 +237,16 @@ func startWorks(config *Config) {
 	finChan := make(chan bool)
 	wg := sync.WaitGroup{}
 
-	// filters
-	var filters []lecimg.Filter
+	// filters. strips of webtoons are cut into pages before other filters.
+	pipeline := lecimg.NewPipeline(config.errorPolicy)
+	if config.webtoon.enabled {
+		pipeline.AddFilter("splitTall", config.webtoon.filter, nil)
+	}
 	for _, filterOption := range config.filterOptions {
-		filters = append(filters, filterOption.filter)
+		pipeline.AddFilter(filterOption.name, filterOption.filter, filterOption.selector)
 	}
+	pipeline.SetDeviceSize(config.width, config.height)
+	pipeline.SetPageQuality(config.pageQuality)
 
 	// Destination information
 	destInfo := getDestDirInfo(config)
@@ -191,7 +255,7 @@ func startWorks(config *Config) {
 	}
 
 	// start source images collector
-	go collectImages(workChan, finChan, config, destInfo.dir, filters)
+	go collectImages(workChan, finChan, config, destInfo.dir, pipeline)
 
 	// start workers
 	for i := 0; i < config.maxProcess; i++ {
@@ -210,6 +274,13 @@ func startWorks(config *Config) {
 
 	wg.Wait()
 
+	pipeline.Summary().Log()
+	writeReport(pipeline.Report(), config.report)
+	if pipeline.Aborted() {
+		log.Printf("Aborted.")
+		return
+	}
+
 	// Create output
 	switch destInfo.format {
 	case ".cbz", ".zip":
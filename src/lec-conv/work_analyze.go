@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"lec/lecimg"
+)
+
+// AnalyzeWork runs the analysis pass of a page
+type AnalyzeWork struct {
+	srcDir   string
+	filename string
+	strip    *webtoonStrip // images stitched into a strip in webtoon mode
+	index    int
+	pipeline *lecimg.Pipeline
+	wg       *sync.WaitGroup
+}
+
+func (w AnalyzeWork) Run() bool {
+	defer w.wg.Done()
+
+	if w.pipeline.Aborted() {
+		return false
+	}
+
+	log.Printf("[ANALYZE] %v\n", w.filename)
+
+	src, err := loadSource(w.srcDir, w.filename, w.strip)
+	if err != nil {
+		log.Printf("Error : %v : %v\n", w.filename, err)
+		return false
+	}
+
+	w.pipeline.Analyze(src, w.filename, w.index)
+	return true
+}
+
+func (w AnalyzeWork) IsQuit() bool {
+	return false
+}
@@ -1,11 +1,9 @@
 package main
 
 import (
-	"image"
 	"log"
 	"os"
 	"path/filepath"
-	"reflect"
 	"strings"
 
 	"lec/lecimg"
@@ -15,58 +13,64 @@ import (
 type FilterWork struct {
 	srcDir    string
 	filename  string
+	strip     *webtoonStrip // images stitched into a strip in webtoon mode
 	index     int
 	destDir   string
-	width     int
-	height    int
-	filters   []lecimg.Filter
+	quality   int
+	pipeline  *lecimg.Pipeline
 	removeSrc bool
 }
 
 func (w FilterWork) Run() bool {
-	log.Printf("[READ] %v\n", w.filename)
+	if w.removeSrc {
+		defer func() {
+			if w.strip != nil {
+				w.strip.release()
+			} else {
+				os.Remove(filepath.Join(w.srcDir, w.filename))
+			}
+		}()
+	}
 
-	srcPath := filepath.Join(w.srcDir, w.filename)
-	src, err := lecimg.LoadImage(srcPath)
-	if err != nil {
-		log.Printf("Error : %v : %v\n", w.filename, err)
+	if w.pipeline.Aborted() {
 		return false
 	}
 
-	// run filters
-	var dest image.Image
-	for _, filter := range w.filters {
-		result := filter.Run(lecimg.NewFilterSource(src, w.filename, w.index))
-		result.Log()
-
-		resultImg := result.Img()
-		if resultImg == nil {
-			log.Printf("Filter result is nil. filter: %v\n", reflect.TypeOf(filter))
-			break
-		}
+	log.Printf("[READ] %v\n", w.filename)
 
-		dest = resultImg
-		src = dest
+	src, err := loadSource(w.srcDir, w.filename, w.strip)
+	if err != nil {
+		w.fail(err)
+		return false
 	}
 
-	// resize
-	dest = lecimg.ResizeImage(dest, w.width, w.height, true)
-
-	// save dest Image
-	filename := strings.ToLower(lecio.GetBaseWithoutExt(w.filename)) + ".jpg"
-	err = lecimg.SaveJpeg(dest, w.destDir, filename, 80)
-	if err != nil {
-		log.Printf("Error : %v : %v\n", filename, err)
+	// run filters
+	pages, err := w.pipeline.RunPages(src, w.filename, w.index)
+	if len(pages) == 0 || err != nil {
 		return false
 	}
 
-	if w.removeSrc {
-		os.Remove(srcPath)
+	// save dest Images
+	filename := strings.ToLower(lecio.GetBaseWithoutExt(w.filename)) + ".jpg"
+	for i, dest := range pages {
+		_, err = lecimg.SavePage(dest, w.destDir, lecio.GetPageFilename(filename, i, len(pages)), w.quality)
+		if err != nil {
+			w.fail(err)
+			return false
+		}
 	}
 
 	return true
 }
 
+func (w FilterWork) fail(err error) {
+	w.pipeline.Fail(lecimg.PageError{
+		Filename: w.filename,
+		Index:    w.index,
+		Err:      err,
+	})
+}
+
 func (w FilterWork) IsQuit() bool {
 	return false
 }
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"lec/lecimg"
+	"lec/lecio"
+)
+
+// webtoonStrip is a band of rows of an episode, whose images are stitched
+// from top to bottom after they are scaled to the width of the first image.
+type webtoonStrip struct {
+	dir     string
+	images  []stripImage // images which overlap the strip
+	width   int
+	top     int // y of the strip in the episode
+	bottom  int
+	sources *stripSources
+}
+
+// stripImage is an image of an episode scaled to the width of the episode.
+type stripImage struct {
+	filename string
+	top      int // y of the image in the episode
+	height   int
+}
+
+// stripSources counts the strips which use each source image of an episode,
+// so that an image is removed only after every strip using it is done.
+type stripSources struct {
+	mutex sync.Mutex
+	refs  map[string]int
+}
+
+// groupStrips stitches consecutive images of a directory into an episode
+// and cuts it into strips of works whose height does not exceed maxHeight.
+// Images whose size cannot be read are reported as failed pages and left out of strips.
+func groupStrips(works []FilterWork,
+	maxHeight int,
+	pageRects func(image.Image) ([]image.Rectangle, error),
+	pipeline *lecimg.Pipeline) []FilterWork {
+
+	var strips []FilterWork
+	for start := 0; start < len(works); {
+		end := start + 1
+		for end < len(works) && works[end].srcDir == works[start].srcDir {
+			end++
+		}
+		for _, strip := range episodeStrips(works[start:end], maxHeight, pageRects, pipeline) {
+			strip.index = len(strips)
+			strips = append(strips, strip)
+		}
+		start = end
+	}
+
+	for _, strip := range strips {
+		log.Printf("[STRIP] %v : %v images, rows %v-%v\n",
+			strip.filename, len(strip.strip.images), strip.strip.top, strip.strip.bottom)
+	}
+	return strips
+}
+
+// episodeStrips cuts the images of one directory into strips like a sliding window.
+// pageRects cuts the window of maxHeight rows into pages, the strip ends at the
+// bottom of the last full page and the rest below it is carried into the next strip.
+// Strips thus break only where pages are cut, and one window is in memory at a time.
+// Strips are named after the first image with a strip number so that pages keep their order.
+func episodeStrips(works []FilterWork,
+	maxHeight int,
+	pageRects func(image.Image) ([]image.Rectangle, error),
+	pipeline *lecimg.Pipeline) []FilterWork {
+
+	var first FilterWork
+	var images []stripImage
+	width, height := 0, 0
+	for _, work := range works {
+		w, h, err := imageSize(filepath.Join(work.srcDir, work.filename))
+		if err != nil {
+			pipeline.Fail(lecimg.PageError{Filename: work.filename, Index: work.index, Err: err})
+			continue
+		}
+		if width == 0 {
+			first, width = work, w
+		}
+		h = lecimg.Max(1, h*width/w)
+		images = append(images, stripImage{work.filename, height, h})
+		height += h
+	}
+	if len(images) == 0 {
+		return nil
+	}
+
+	var bands [][2]int
+	for top := 0; top < height; {
+		bottom := lecimg.Min(top+maxHeight, height)
+		next := bottom
+		if bottom < height {
+			// a window which fails to load is cut at maxHeight,
+			// and the strips using it report the error when they are loaded.
+			window := newWebtoonStrip(first.srcDir, images, width, top, bottom, nil)
+			if img, err := window.load(); err == nil {
+				if rects, err := pageRects(img); err == nil && len(rects) > 1 {
+					bottom = top + rects[len(rects)-2].Max.Y
+					next = top + rects[len(rects)-1].Min.Y
+				}
+			}
+		}
+		bands = append(bands, [2]int{top, bottom})
+		top = next
+	}
+
+	sources := &stripSources{refs: map[string]int{}}
+	var strips []FilterWork
+	for i, band := range bands {
+		work := first
+		work.filename = lecio.GetPageFilename(first.filename, i, len(bands))
+		work.strip = newWebtoonStrip(first.srcDir, images, width, band[0], band[1], sources)
+		for _, img := range work.strip.images {
+			sources.refs[img.filename]++
+		}
+		strips = append(strips, work)
+	}
+	return strips
+}
+
+// newWebtoonStrip returns the strip of rows from top to bottom of the episode.
+func newWebtoonStrip(dir string, images []stripImage, width, top, bottom int, sources *stripSources) *webtoonStrip {
+	strip := webtoonStrip{dir: dir, width: width, top: top, bottom: bottom, sources: sources}
+	for _, img := range images {
+		if img.top < bottom && img.top+img.height > top {
+			strip.images = append(strip.images, img)
+		}
+	}
+	return &strip
+}
+
+// load stitches the images of the strip and keeps the rows of the strip.
+func (s *webtoonStrip) load() (image.Image, error) {
+	dest := lecimg.CreateImage(s.width, s.bottom-s.top, color.White)
+	for _, stripImg := range s.images {
+		img, err := lecimg.LoadImage(filepath.Join(s.dir, stripImg.filename))
+		if err != nil {
+			return nil, err
+		}
+		bounds := img.Bounds()
+		if bounds.Dx() != s.width {
+			img = lecimg.ResizeImage(img, s.width, stripImg.height, false)
+			bounds = img.Bounds()
+		}
+		y := stripImg.top - s.top
+		draw.Draw(dest, image.Rect(0, y, s.width, y+bounds.Dy()), img, bounds.Min, draw.Src)
+	}
+	return dest, nil
+}
+
+// release removes the source images which no other strip uses any more.
+func (s *webtoonStrip) release() {
+	s.sources.mutex.Lock()
+	defer s.sources.mutex.Unlock()
+
+	for _, img := range s.images {
+		s.sources.refs[img.filename]--
+		if s.sources.refs[img.filename] <= 0 {
+			os.Remove(filepath.Join(s.dir, img.filename))
+		}
+	}
+}
+
+// imageSize returns the size of the image without decoding the pixels.
+func imageSize(filename string) (int, int, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return 0, 0, errors.New("empty image")
+	}
+	return config.Width, config.Height, nil
+}
+
+// loadSource loads the image of a work.
+// Images of the strip are stitched from top to bottom in webtoon mode.
+func loadSource(dir string, filename string, strip *webtoonStrip) (image.Image, error) {
+	if strip == nil {
+		return lecimg.LoadImage(filepath.Join(dir, filename))
+	}
+	return strip.load()
+}
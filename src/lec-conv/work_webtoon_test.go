@@ -0,0 +1,122 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lec/lecimg"
+)
+
+// createWebtoonImage draws a dark image with white gaps every fifth of the height.
+func createWebtoonImage(width, height int) *image.RGBA {
+	img := lecimg.CreateImage(width, height, color.Black)
+	step := height / 5
+	for y := step / 2; y < height; y += step {
+		lecimg.FillRect(img, 0, y, width, y+height/20, color.White)
+	}
+	return img
+}
+
+func TestWebtoonStrips(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webtoon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 100x300, 200x400 (scaled to 100x200), 100x300, 100x300
+	sizes := [][2]int{{100, 300}, {200, 400}, {100, 300}, {100, 300}}
+	filenames := []string{"01.png", "02.png", "03.png", "04.png"}
+	var works []FilterWork
+	for i, size := range sizes {
+		if err := lecimg.SavePng(createWebtoonImage(size[0], size[1]), dir, filenames[i]); err != nil {
+			t.Fatal(err)
+		}
+		works = append(works, FilterWork{srcDir: dir, filename: filenames[i], index: i})
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "05.png"), []byte("broken"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	works = append(works, FilterWork{srcDir: dir, filename: "05.png", index: 4})
+
+	filter := lecimg.NewSplitTallFilter(lecimg.SplitTallOption{Threshold: 240, Width: 100, Height: 150})
+	pageRects := func(img image.Image) ([]image.Rectangle, error) {
+		return filter.PageRects(img, 0, 0)
+	}
+	pipeline := lecimg.NewPipeline(lecimg.PassThroughOnError)
+	strips := groupStrips(works, 400, pageRects, pipeline)
+
+	if failures := pipeline.Summary().Failures(); len(failures) != 1 || failures[0].Filename != "05.png" {
+		t.Errorf("unreadable image should be reported. actual=%v", failures)
+	}
+
+	// broken pixels are reported when strips are loaded, not while grouping them
+	data, err := lecimg.ToPngBytes(createWebtoonImage(100, 900))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "06.png"), data[:len(data)/2], 0666); err != nil {
+		t.Fatal(err)
+	}
+	broken := groupStrips([]FilterWork{{srcDir: dir, filename: "06.png"}}, 400, pageRects, pipeline)
+	if failures := pipeline.Summary().Failures(); len(failures) != 1 || len(broken) != 3 {
+		t.Errorf("broken image should be cut at max height without a failure. strips=%v, failures=%v", len(broken), failures)
+	}
+	if len(strips) < 3 || strips[0].strip.top != 0 || strips[len(strips)-1].strip.bottom != 1100 {
+		t.Fatalf("strips should cover the episode. strips=%v", len(strips))
+	}
+	if strips[0].filename != "01-001.png" || strips[1].filename != "01-002.png" || strips[1].index != 1 {
+		t.Errorf("strip names mismatch. filename=%v, index=%v", strips[1].filename, strips[1].index)
+	}
+
+	for i, work := range strips {
+		strip := work.strip
+		if strip.bottom-strip.top > 400 {
+			t.Errorf("strip %v is too tall. rows=%v-%v", i, strip.top, strip.bottom)
+		}
+		img, err := loadSource(dir, work.filename, strip)
+		if err != nil {
+			t.Fatalf("failed to load strip : %v", err)
+		}
+		if bounds := img.Bounds(); bounds.Dx() != 100 || bounds.Dy() != strip.bottom-strip.top {
+			t.Errorf("strip %v size mismatch. actual=%v", i, bounds)
+		}
+		if i == len(strips)-1 {
+			break
+		}
+
+		// the rest below the last cut is carried into the next strip
+		next := strips[i+1].strip
+		if next.top <= strip.top || next.top > strip.bottom {
+			t.Errorf("strip %v should start at the last cut of the previous strip. rows=%v-%v, next=%v",
+				i+1, strip.top, strip.bottom, next.top)
+		}
+		if r, _, _, _ := img.At(50, img.Bounds().Dy()-1).RGBA(); r < 0xf000 {
+			t.Errorf("strip %v should end in a gap. rows=%v-%v", i, strip.top, strip.bottom)
+		}
+	}
+
+	// images are stitched from top to bottom
+	img, _ := loadSource(dir, strips[0].filename, strips[0].strip)
+	if r, _, _, _ := img.At(50, 2).RGBA(); r > 0x8000 {
+		t.Errorf("top of the first image should be dark")
+	}
+
+	// source images are removed after the last strip using them
+	for i := len(strips) - 1; i > 0; i-- {
+		strips[i].strip.release()
+	}
+	if _, err := os.Stat(filepath.Join(dir, "01.png")); err != nil {
+		t.Errorf("image of the first strip should not be removed yet")
+	}
+	strips[0].strip.release()
+	for _, filename := range filenames {
+		if _, err := os.Stat(filepath.Join(dir, filename)); err == nil {
+			t.Errorf("%v should be removed", filename)
+		}
+	}
+}
@@ -20,8 +20,9 @@ type DestOption struct {
 }
 
 type FilterOption struct {
-	name   string
-	filter lecimg.Filter
+	name     string
+	filter   lecimg.Filter
+	selector *lecimg.PageSelector
 }
 
 type Config struct {
@@ -30,6 +31,9 @@ type Config struct {
 	watch         bool
 	watchDelay    int
 	maxProcess    int
+	errorPolicy   lecimg.ErrorPolicy
+	report        string
+	pageQuality   int // jpeg quality of page files
 	filterOptions []FilterOption
 }
 
@@ -51,6 +55,12 @@ func (c *Config) LoadYaml(filename string) {
 	if c.maxProcess <= 0 {
 		c.maxProcess = runtime.NumCPU()
 	}
+	c.errorPolicy, err = lecimg.ParseErrorPolicy(cfg.UString("onError", ""))
+	if err != nil {
+		log.Fatalf("Error : %v : %v\n", filename, err)
+	}
+	c.report = cfg.UString("report", "")
+	c.pageQuality = cfg.UInt("pageQuality", lecimg.DefaultPageQuality)
 
 	// Load filters
 	for i := 0; ; i++ {
@@ -63,45 +73,38 @@ func (c *Config) LoadYaml(filename string) {
 			continue
 		}
 
-		c.addFilterOption(name.(string), m["options"].(map[string]interface{}))
+		pages, err := lecimg.PageSelectorExpr(m["pages"])
+		if err != nil {
+			log.Printf("Failed to read filter pages : %v : %v\n", name, err)
+			continue
+		}
+		options, _ := m["options"].(map[string]interface{})
+		c.addFilterOption(name.(string), pages, options)
 	}
 }
 
-func (c *Config) addFilterOption(name string, options map[string]interface{}) {
-	var err error
-	var filter lecimg.Filter
-
-	switch name {
-	case "deskew":
-		if option, err := lecimg.NewDeskewOption(options); err == nil {
-			filter = lecimg.NewDeskewFilter(*option)
-		}
-	case "deskewED":
-		if option, err := lecimg.NewDeskewEDOption(options); err == nil {
-			filter = lecimg.NewDeskewEDFilter(*option)
-		}
-	case "autoCrop":
-		if option, err := lecimg.NewAutoCropOption(options); err == nil {
-			filter = lecimg.NewAutoCropFilter(*option)
-		}
-	case "autoCropED":
-		if option, err := lecimg.NewAutoCropEDOption(options); err == nil {
-			filter = lecimg.NewAutoCropEDFilter(*option)
-		}
-	default:
-		log.Printf("Unhandled filter name : %v\n", name)
+func (c *Config) addFilterOption(name string, pages string, options map[string]interface{}) {
+	filter, err := lecimg.NewFilter(name, options)
+	if err != nil {
+		log.Printf("Failed to read filter : %v : %v\n", name, err)
+		return
+	}
+	selector, err := lecimg.NewPageSelector(pages)
+	if err != nil {
+		log.Printf("Failed to read filter pages : %v : %v\n", name, err)
+		return
 	}
 
-	if filter != nil {
-		filterOption := FilterOption{
-			name:   name,
-			filter: filter,
-		}
-		c.filterOptions = append(c.filterOptions, filterOption)
-		fmt.Printf("Filter added : %v\n", name)
+	filterOption := FilterOption{
+		name:     name,
+		filter:   filter,
+		selector: selector,
 	}
-	if err != nil {
-		log.Printf("Failed to read filter : %v : %v\n", name, err)
+	c.filterOptions = append(c.filterOptions, filterOption)
+	if selector != nil {
+		fmt.Printf("Filter added : %v (pages: %v)\n", name, selector)
+	} else {
+		fmt.Printf("Filter added : %v\n", name)
 	}
 }
 
@@ -110,11 +113,14 @@ func (c *Config) Print() {
 	fmt.Printf("dest.dir : %v\n", c.dest.dir)
 	fmt.Printf("watch : %v\n", c.watch)
 	fmt.Printf("maxProcess : %v\n", c.maxProcess)
+	fmt.Printf("onError : %v\n", c.errorPolicy)
+	fmt.Printf("report : %v\n", c.report)
+	fmt.Printf("pageQuality : %v%%\n", c.pageQuality)
 	fmt.Printf("filters : %v\n", len(c.filterOptions))
 }
 
 func NewConfig(cfgFilename string, srcDir string, destDir string, watch bool) *Config {
-	cfg := Config{}
+	cfg := Config{pageQuality: lecimg.DefaultPageQuality}
 
 	if cfgFilename != "" {
 		cfg.LoadYaml(cfgFilename)
@@ -1,22 +1,23 @@
 package main
 
 import (
-	"image"
 	"log"
 	"os"
 	"path/filepath"
-	"reflect"
 	"runtime"
 	"sync"
 	"time"
 
 	"lec/lecimg"
+	"lec/lecio"
 )
 
 // Work represents a job to do
 type Work struct {
 	dir      string
 	filename string
+	index    int
+	analysis *sync.WaitGroup // not nil for the analysis pass
 	quit     bool
 }
 
@@ -25,7 +26,7 @@ type Worker struct {
 	workChan <-chan Work
 }
 
-func collectImages(workChan chan<- Work, finChan chan<- bool, srcDir string, watch bool, watchDelay int) {
+func collectImages(workChan chan<- Work, finChan chan<- bool, srcDir string, watch bool, watchDelay int, pipeline *lecimg.Pipeline) {
 	defer func() {
 		finChan <- true
 	}()
@@ -42,9 +43,33 @@ func collectImages(workChan chan<- Work, finChan chan<- bool, srcDir string, wat
 			break
 		}
 
+		// page index is known only in batch mode.
+		if !watch {
+			pipeline.SetPageCount(len(files))
+
+			// analysis passes
+			for pipeline.NeedsAnalysis() {
+				analysisWg := sync.WaitGroup{}
+				for i, file := range files {
+					analysisWg.Add(1)
+					workChan <- Work{dir: srcDir, filename: file.Name(), index: i, analysis: &analysisWg}
+				}
+				analysisWg.Wait()
+				pipeline.EndAnalysis()
+			}
+		}
+
 		// add works
-		for _, file := range files {
-			workChan <- Work{srcDir, file.Name(), false}
+		for i, file := range files {
+			index := i
+			if watch {
+				index = -1
+			}
+			workChan <- Work{dir: srcDir, filename: file.Name(), index: index}
+		}
+
+		if pipeline.Aborted() {
+			break
 		}
 
 		if watch {
@@ -56,7 +81,7 @@ func collectImages(workChan chan<- Work, finChan chan<- bool, srcDir string, wat
 	}
 }
 
-func work(worker Worker, filters []lecimg.Filter, destDir string, wg *sync.WaitGroup) {
+func work(worker Worker, pipeline *lecimg.Pipeline, destDir string, quality int, wg *sync.WaitGroup) {
 	defer func() {
 		wg.Done()
 	}()
@@ -66,37 +91,60 @@ func work(worker Worker, filters []lecimg.Filter, destDir string, wg *sync.WaitG
 		if work.quit {
 			break
 		}
+		if work.analysis != nil {
+			analyze(work, pipeline)
+			continue
+		}
+		if pipeline.Aborted() {
+			continue
+		}
 
 		log.Printf("[R] %v\n", work.filename)
 
 		src, err := lecimg.LoadImage(filepath.Join(work.dir, work.filename))
 		if err != nil {
-			log.Printf("Error : %v : %v\n", work.filename, err)
+			pipeline.Fail(lecimg.PageError{Filename: work.filename, Index: work.index, Err: err})
 			continue
 		}
 
 		// run filters
-		var dest image.Image
-		for _, filter := range filters {
-			result := filter.Run(lecimg.NewFilterSource(src, work.filename, -1))
-			result.Log()
-
-			resultImg := result.Img()
-			if resultImg == nil {
-				log.Printf("Filter result is nil. filter: %v\n", reflect.TypeOf(filter))
+		pages, err := pipeline.RunPages(src, work.filename, work.index)
+		if len(pages) == 0 || err != nil {
+			continue
+		}
+
+		// save dest Imgs
+		for i, dest := range pages {
+			_, err = lecimg.SavePage(dest, destDir, lecio.GetPageFilename(work.filename, i, len(pages)), quality)
+			if err != nil {
+				pipeline.Fail(lecimg.PageError{Filename: work.filename, Index: work.index, Err: err})
 				break
 			}
-
-			dest = resultImg
-			src = dest
 		}
+	}
+}
 
-		// save dest Img
-		err = lecimg.SaveJpeg(dest, destDir, work.filename, 80)
-		if err != nil {
-			log.Printf("Error : %v : %v\n", work.filename, err)
-			continue
-		}
+func analyze(work Work, pipeline *lecimg.Pipeline) {
+	defer work.analysis.Done()
+
+	log.Printf("[A] %v\n", work.filename)
+
+	src, err := lecimg.LoadImage(filepath.Join(work.dir, work.filename))
+	if err != nil {
+		log.Printf("Error : %v : %v\n", work.filename, err)
+		return
+	}
+	pipeline.Analyze(src, work.filename, work.index)
+}
+
+func writeReport(report *lecimg.Report, filename string) {
+	if filename == "" {
+		return
+	}
+
+	log.Printf("[W] %v\n", filename)
+	if err := report.Write(filename); err != nil {
+		log.Printf("Error : %v : %v\n", filename, err)
 	}
 }
 
@@ -111,19 +159,23 @@ func startWorks(config *Config) {
 	// WaitGroup
 	wg := sync.WaitGroup{}
 
-	// start collector
-	go collectImages(workChan, finChan, config.src.dir, config.watch, config.watchDelay)
-
-	var filters []lecimg.Filter
+	pipeline := lecimg.NewPipeline(config.errorPolicy)
 	for _, filterOption := range config.filterOptions {
-		filters = append(filters, filterOption.filter)
+		pipeline.AddFilter(filterOption.name, filterOption.filter, filterOption.selector)
+	}
+	pipeline.SetPageQuality(config.pageQuality)
+	if config.watch && pipeline.NeedsAnalysis() {
+		log.Printf("Analysis pass is disabled in watch mode. Book-level filters process each page alone.\n")
 	}
 
+	// start collector
+	go collectImages(workChan, finChan, config.src.dir, config.watch, config.watchDelay, pipeline)
+
 	// start workers
 	for i := 0; i < config.maxProcess; i++ {
 		worker := Worker{workChan}
 		wg.Add(1)
-		go work(worker, filters, config.dest.dir, &wg)
+		go work(worker, pipeline, config.dest.dir, config.pageQuality, &wg)
 	}
 
 	// wait for collector finish
@@ -131,8 +183,14 @@ func startWorks(config *Config) {
 
 	// finish workers
 	for i := 0; i < config.maxProcess; i++ {
-		workChan <- Work{"", "", true}
+		workChan <- Work{index: -1, quit: true}
 	}
 
 	wg.Wait()
+
+	pipeline.Summary().Log()
+	writeReport(pipeline.Report(), config.report)
+	if pipeline.Aborted() {
+		log.Printf("Aborted.")
+	}
 }
@@ -13,6 +13,8 @@ import (
 // ----------------------------------------------------------------------------
 type AutoCropOption struct {
 	Threshold            uint8   // min brightness of space (0~255)
+	AutoThreshold        bool    // selects Threshold of each page by Otsu's method ("threshold: auto")
+	LockThreshold        bool    // uses one auto threshold for the book
 	MinRatio             float32 // min cropped ratio (height / width)
 	MaxRatio             float32 // max cropped ratio (height / width)
 	MaxWidthCropRate     float32 // max width crop rate (0 <= rate < 1.0)
@@ -30,20 +32,40 @@ type AutoCropOption struct {
 	MaxCropBottom        int
 	MaxCropLeft          int
 	MaxCropRight         int
+	UniformCrop          string           // "" : per page, "book" : per book, "oddEven" : per odd/even pages
+	DebugOutputDir       string           // writes annotated images if not empty
+	Despeckle            *DespeckleOption // ignores specks in edge detection without changing output
+	Flatten              *FlattenOption   // flattens lighting for edge detection without changing output
 }
 
 func NewAutoCropOption(m map[string]interface{}) (*AutoCropOption, error) {
 	option := AutoCropOption{}
 
+	m, auto := parseAutoThreshold(m)
 	err := mapstructure.Decode(m, &option)
 	if err != nil {
 		return nil, err
 	}
+	option.AutoThreshold = option.AutoThreshold || auto
+	if err := validateUniformCrop(option.UniformCrop); err != nil {
+		return nil, err
+	}
+	if option.Despeckle != nil {
+		if err := option.Despeckle.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if option.Flatten != nil {
+		if err := option.Flatten.validate(); err != nil {
+			return nil, err
+		}
+	}
 
 	return &option, nil
 }
 
 type AutoCropResult struct {
+	thresholdResult
 	image image.Image
 	rect  image.Rectangle
 }
@@ -53,37 +75,157 @@ func (r AutoCropResult) Img() image.Image {
 }
 
 func (r AutoCropResult) Log() {
+	r.logThreshold()
+}
+
+func (r AutoCropResult) Report(report *PageReport) {
+	report.CropRect = NewReportRect(r.rect)
+	r.reportThreshold(report)
 }
 
 // ----------------------------------------------------------------------------
 // ----------------------------------------------------------------------------
 type AutoCropFilter struct {
-	option AutoCropOption
+	option    AutoCropOption
+	uniform   *uniformCrop
+	threshold *autoThreshold
 }
 
 // Create AutoCropFilter instance
 func NewAutoCropFilter(option AutoCropOption) *AutoCropFilter {
-	return &AutoCropFilter{option: option}
+	return &AutoCropFilter{
+		option:    option,
+		uniform:   newUniformCrop(option.UniformCrop),
+		threshold: newAutoThreshold(option.AutoThreshold, option.LockThreshold),
+	}
+}
+
+func init() {
+	RegisterFilter("autoCrop", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewAutoCropOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewAutoCropFilter(*option), nil
+	})
 }
 
 // Implements Filter.Run()
-func (f AutoCropFilter) Run(s *FilterSource) FilterResult {
-	img, rect := f.run(s.image)
-	return AutoCropResult{img, rect}
+func (f AutoCropFilter) Run(s *FilterSource) (FilterResult, error) {
+	f.option.DebugOutputDir = s.debugOutputDir(f.option.DebugOutputDir)
+	detect := flattenedImage(s.image, f.option.Flatten)
+	if f.threshold.enabled() {
+		f.option.Threshold = f.threshold.get(detect)
+	}
+	img, rect := f.run(s.image, detect, s.filename, s.parityIndex())
+	return AutoCropResult{thresholdResult{s.filename, f.threshold.enabled(), f.option.Threshold}, img, rect}, nil
+}
+
+// Implements BookFilter.NeedsAnalysis()
+func (f AutoCropFilter) NeedsAnalysis() bool {
+	return f.uniform.enabled() || f.threshold.needsAnalysis()
+}
+
+// Implements MultiPassFilter.AnalysisPasses().
+// The book threshold is locked in the first pass before edges are found
+// with it in the second pass.
+func (f AutoCropFilter) AnalysisPasses() int {
+	if f.uniform.enabled() && f.threshold.needsAnalysis() {
+		return 2
+	}
+	return 1
+}
+
+// Implements BookFilter.Analyze()
+func (f AutoCropFilter) Analyze(s *FilterSource) error {
+	detect := flattenedImage(s.image, f.option.Flatten)
+	if f.threshold.needsAnalysis() && !f.threshold.analysisEnded() {
+		f.threshold.add(detect)
+		return nil
+	}
+	if !f.uniform.enabled() {
+		return nil
+	}
+	if f.threshold.enabled() {
+		f.option.Threshold = f.threshold.get(detect)
+	}
+
+	bounds := s.image.Bounds()
+	left, top, right, bottom := f.findEdges(detectionImage(detect, f.option.Despeckle, f.option.Threshold))
+	if top < bounds.Dy() {
+		f.uniform.add(s.parityIndex(), image.Rect(left, top, right+1, bottom+1))
+	}
+	return nil
+}
+
+// Implements BookFilter.EndAnalysis()
+func (f AutoCropFilter) EndAnalysis() {
+	if f.threshold.needsAnalysis() && !f.threshold.analysisEnded() {
+		f.threshold.endAnalysis()
+		return
+	}
+	if f.uniform.enabled() {
+		f.uniform.end()
+	}
 }
 
-// actual autoCrop implementation
-func (f AutoCropFilter) run(src image.Image) (image.Image, image.Rectangle) {
+// actual autoCrop implementation. edges are detected in detect and src is cropped.
+func (f AutoCropFilter) run(src, detect image.Image, filename string, index int) (image.Image, image.Rectangle) {
 	bounds := src.Bounds()
 	o := f.option
 
 	// calculate boundary
 	width, height := bounds.Dx(), bounds.Dy()
+	detect = detectionImage(detect, o.Despeckle, o.Threshold)
+	left, top, right, bottom := f.findEdges(detect)
+	if rect, ok := f.uniform.get(index); ok {
+		left, top = rect.Min.X, rect.Min.Y
+		right, bottom = Min(width, rect.Max.X)-1, Min(height, rect.Max.Y)-1
+	}
+
+	// crop image
+	if top > 0 || left > 0 || right+1 < width || bottom+1 < height {
+		cropRect := GetCropRect(left, top, right+1, bottom+1, bounds, o.MaxWidthCropRate, o.MaxHeightCropRate, o.MinRatio, o.MaxRatio)
+		if o.DebugOutputDir != "" {
+			f.saveDebugImage(detect, filename, left, top, right, bottom, cropRect)
+		}
+		dest := image.NewRGBA(cropRect)
+		draw.Draw(dest, dest.Bounds(), &image.Uniform{color.White}, image.ZP, draw.Src)
+		crop := gift.New(gift.Crop(cropRect))
+		crop.Draw(dest, src)
+		return dest, cropRect
+	} else {
+		if o.DebugOutputDir != "" {
+			f.saveDebugImage(detect, filename, left, top, right, bottom, bounds)
+		}
+		return src, bounds
+	}
+}
+
+// saveDebugImage writes the thresholded image with detected rectangles.
+func (f AutoCropFilter) saveDebugImage(src image.Image, filename string, left, top, right, bottom int, cropRect image.Rectangle) {
+	o := f.option
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	img := newThresholdDebugImage(src, o.Threshold)
+	padding := image.Rect(o.PaddingLeft, o.PaddingTop, width-o.PaddingRight, height-o.PaddingBottom)
+	content := image.Rect(left+o.MarginLeft, top+o.MarginTop, right+1-o.MarginRight, bottom+1-o.MarginBottom)
+	drawCropDebug(img, padding, content, cropRect)
+	saveDebugImage(img, o.DebugOutputDir, filename, "autoCrop")
+}
 
-	top := f.findTopEdge(src, width, height)
-	bottom := f.findBottomEdge(src, width, height, top)
-	left := f.findLeftEdge(src, width, height, top, bottom)
-	right := f.findRightEdge(src, width, height, top, bottom, left)
+// findEdges returns content edges limited by maxCrop options.
+func (f AutoCropFilter) findEdges(src image.Image) (left, top, right, bottom int) {
+	bounds := src.Bounds()
+	o := f.option
+
+	width, height := bounds.Dx(), bounds.Dy()
+
+	top = f.findTopEdge(src, width, height)
+	bottom = f.findBottomEdge(src, width, height, top)
+	left = f.findLeftEdge(src, width, height, top, bottom)
+	right = f.findRightEdge(src, width, height, top, bottom, left)
 
 	// maxCrop
 	disableMaxCrop := o.MaxCropTop == 0 &&
@@ -104,18 +246,22 @@ func (f AutoCropFilter) run(src image.Image) (image.Image, image.Rectangle) {
 			right = Max(width-o.MaxCropRight, right)
 		}
 	}
+	return
+}
 
-	// crop image
-	if top > 0 || left > 0 || right+1 < width || bottom+1 < height {
-		cropRect := GetCropRect(left, top, right+1, bottom+1, bounds, o.MaxWidthCropRate, o.MaxHeightCropRate, o.MinRatio, o.MaxRatio)
-		dest := image.NewRGBA(cropRect)
-		draw.Draw(dest, dest.Bounds(), &image.Uniform{color.White}, image.ZP, draw.Src)
-		crop := gift.New(gift.Crop(cropRect))
-		crop.Draw(dest, src)
-		return dest, cropRect
-	} else {
-		return src, bounds
+// countLineDots counts dots darker than thresholdSum in the row y from xStart to xEnd.
+// It stops counting when the count exceeds maxDotCount. Negative maxDotCount counts all dots.
+func countLineDots(image image.Image, y, xStart, xEnd int, thresholdSum uint32, maxDotCount int) int {
+	dotCount := 0
+	for x := xStart; x < xEnd; x++ {
+		if r, g, b, _ := image.At(x, y).RGBA(); (r + g + b) < thresholdSum {
+			dotCount++
+			if maxDotCount >= 0 && dotCount > maxDotCount {
+				break
+			}
+		}
 	}
+	return dotCount
 }
 
 // Find top edge. 0 <= threshold <= 0xffff
@@ -125,14 +271,8 @@ func (f AutoCropFilter) findTopEdge(image image.Image, width, height int) int {
 	xEnd := width - f.option.PaddingRight
 	maxDotCount := f.option.EmptyLineMaxDotCount
 	for y := f.option.PaddingTop; y < yEnd; y++ {
-		dotCount := 0
-		for x := f.option.PaddingLeft; x < xEnd; x++ {
-			if r, g, b, _ := image.At(x, y).RGBA(); (r + g + b) < thresholdSum {
-				dotCount++
-				if dotCount > maxDotCount {
-					return Max(0, y-f.option.MarginTop)
-				}
-			}
+		if countLineDots(image, y, f.option.PaddingLeft, xEnd, thresholdSum, maxDotCount) > maxDotCount {
+			return Max(0, y-f.option.MarginTop)
 		}
 	}
 	return height
@@ -29,6 +29,8 @@ type AutoCropEDOption struct {
 	MaxCropBottom        int
 	MaxCropLeft          int
 	MaxCropRight         int
+	UniformCrop          string // "" : per page, "book" : per book, "oddEven" : per odd/even pages
+	DebugOutputDir       string // writes annotated images if not empty
 }
 
 // NewAutoCropEDOption creates an instance of AutoCropEDOption.
@@ -39,6 +41,9 @@ func NewAutoCropEDOption(m map[string]interface{}) (*AutoCropEDOption, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := validateUniformCrop(option.UniformCrop); err != nil {
+		return nil, err
+	}
 
 	return &option, nil
 }
@@ -58,10 +63,16 @@ func (r AutoCropEDResult) Img() image.Image {
 func (r AutoCropEDResult) Log() {
 }
 
+// Report adds the crop rectangle to the page report.
+func (r AutoCropEDResult) Report(report *PageReport) {
+	report.CropRect = NewReportRect(r.rect)
+}
+
 // AutoCropEDFilter crops image automatically using EdgeDetection.
 type AutoCropEDFilter struct {
 	edgeDetect *gift.GIFT
 	option     AutoCropEDOption
+	uniform    *uniformCrop
 }
 
 // NewAutoCropEDFilter creates an instance of AutoCropEDFilter.
@@ -78,34 +89,117 @@ func NewAutoCropEDFilter(option AutoCropEDOption) *AutoCropEDFilter {
 	return &AutoCropEDFilter{
 		edgeDetect: edgeDetect,
 		option:     option,
+		uniform:    newUniformCrop(option.UniformCrop),
 	}
 }
 
+func init() {
+	RegisterFilter("autoCropED", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewAutoCropEDOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewAutoCropEDFilter(*option), nil
+	})
+}
+
 // Run processes an image
-func (f AutoCropEDFilter) Run(s *FilterSource) FilterResult {
-	img, rect := f.run(s.image)
-	return AutoCropEDResult{img, rect}
+func (f AutoCropEDFilter) Run(s *FilterSource) (FilterResult, error) {
+	f.option.DebugOutputDir = s.debugOutputDir(f.option.DebugOutputDir)
+	img, rect := f.run(s.image, s.filename, s.parityIndex())
+	return AutoCropEDResult{img, rect}, nil
+}
+
+// NeedsAnalysis returns true if uniform crop is enabled.
+func (f AutoCropEDFilter) NeedsAnalysis() bool {
+	return f.uniform.enabled()
+}
+
+// Analyze collects the content rectangle of a page.
+func (f AutoCropEDFilter) Analyze(s *FilterSource) error {
+	bounds := s.image.Bounds()
+	left, top, right, bottom := f.findEdges(s.image)
+	if top < bounds.Dy() {
+		f.uniform.add(s.parityIndex(), image.Rect(left, top, right+1, bottom+1))
+	}
+	return nil
+}
+
+// EndAnalysis logs the uniform crop rectangle.
+func (f AutoCropEDFilter) EndAnalysis() {
+	f.uniform.end()
 }
 
 // actual autoCrop implementation
-func (f AutoCropEDFilter) run(src image.Image) (image.Image, image.Rectangle) {
+func (f AutoCropEDFilter) run(src image.Image, filename string, index int) (image.Image, image.Rectangle) {
 	bounds := src.Bounds()
 	o := f.option
 
-	// Edge Detect
+	// calculate boundary
+	width, height := bounds.Dx(), bounds.Dy()
+	left, top, right, bottom := f.findEdges(src)
+	if rect, ok := f.uniform.get(index); ok {
+		left, top = rect.Min.X, rect.Min.Y
+		right, bottom = Min(width, rect.Max.X)-1, Min(height, rect.Max.Y)-1
+	}
+
+	// crop image
+	if top > 0 || left > 0 || right+1 < width || bottom+1 < height {
+		cropRect := GetCropRect(left,
+			top,
+			right+1,
+			bottom+1,
+			bounds,
+			o.MaxWidthCropRate,
+			o.MaxHeightCropRate,
+			o.MinRatio,
+			o.MaxRatio)
+		if o.DebugOutputDir != "" {
+			f.saveDebugImage(src, filename, left, top, right, bottom, cropRect)
+		}
+		dest := image.NewRGBA(cropRect)
+		draw.Draw(dest, dest.Bounds(), &image.Uniform{color.White}, image.ZP, draw.Src)
+		crop := gift.New(gift.Crop(cropRect))
+		crop.Draw(dest, src)
+		return dest, cropRect
+	}
+	if o.DebugOutputDir != "" {
+		f.saveDebugImage(src, filename, left, top, right, bottom, bounds)
+	}
+	return src, bounds
+}
+
+// saveDebugImage writes the edge detected image with detected rectangles.
+func (f AutoCropEDFilter) saveDebugImage(src image.Image, filename string, left, top, right, bottom int, cropRect image.Rectangle) {
+	o := f.option
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
 	edgeDetected := image.NewGray(bounds)
 	f.edgeDetect.Draw(edgeDetected, src)
+	img := newDebugImage(edgeDetected)
+
+	padding := image.Rect(o.PaddingLeft, o.PaddingTop, width-o.PaddingRight, height-o.PaddingBottom)
+	content := image.Rect(left+o.MarginLeft, top+o.MarginTop, right+1-o.MarginRight, bottom+1-o.MarginBottom)
+	drawCropDebug(img, padding, content, cropRect)
+	saveDebugImage(img, o.DebugOutputDir, filename, "autoCropED")
+}
 
-	//	SaveJpeg(src, "./", "autoCropSrc.jpg", 80)
-	//	SaveJpeg(edgeDetected, "./", "autoCropED.jpg", 80)
+// findEdges returns content edges limited by maxCrop options.
+func (f AutoCropEDFilter) findEdges(src image.Image) (left, top, right, bottom int) {
+	bounds := src.Bounds()
+	o := f.option
+
+	// Edge Detect
+	edgeDetected := image.NewGray(bounds)
+	f.edgeDetect.Draw(edgeDetected, src)
 
-	// calculate boundary
 	width, height := bounds.Dx(), bounds.Dy()
 
-	top := f.findTopEdge(edgeDetected, width, height) + 1
-	bottom := f.findBottomEdge(edgeDetected, width, height, top)
-	left := f.findLeftEdge(edgeDetected, width, height, top, bottom) + 1
-	right := f.findRightEdge(edgeDetected, width, height, top, bottom, left)
+	top = f.findTopEdge(edgeDetected, width, height) + 1
+	bottom = f.findBottomEdge(edgeDetected, width, height, top)
+	left = f.findLeftEdge(edgeDetected, width, height, top, bottom) + 1
+	right = f.findRightEdge(edgeDetected, width, height, top, bottom, left)
 
 	// maxCrop
 	disableMaxCrop := o.MaxCropTop == 0 &&
@@ -126,25 +220,7 @@ func (f AutoCropEDFilter) run(src image.Image) (image.Image, image.Rectangle) {
 			right = Max(width-o.MaxCropRight, right)
 		}
 	}
-
-	// crop image
-	if top > 0 || left > 0 || right+1 < width || bottom+1 < height {
-		cropRect := GetCropRect(left,
-			top,
-			right+1,
-			bottom+1,
-			bounds,
-			o.MaxWidthCropRate,
-			o.MaxHeightCropRate,
-			o.MinRatio,
-			o.MaxRatio)
-		dest := image.NewRGBA(cropRect)
-		draw.Draw(dest, dest.Bounds(), &image.Uniform{color.White}, image.ZP, draw.Src)
-		crop := gift.New(gift.Crop(cropRect))
-		crop.Draw(dest, src)
-		return dest, cropRect
-	}
-	return src, bounds
+	return
 }
 
 // Find top edge. 0 <= threshold <= 0xffff
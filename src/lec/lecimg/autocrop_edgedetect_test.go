@@ -9,7 +9,10 @@ import (
 
 func testAutoCropED(t *testing.T, img image.Image, option AutoCropEDOption, expectedWidth, expectedHeight, allowedDelta int) {
 	// Run Filter
-	result := NewAutoCropEDFilter(option).Run(NewFilterSource(img, "filename", 0))
+	result, err := NewAutoCropEDFilter(option).Run(NewFilterSource(img, "filename", 0))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
 
 	// Test result image size
 	destBounds := result.Img().Bounds()
@@ -9,7 +9,10 @@ import (
 
 func testAutoCrop(t *testing.T, img image.Image, option AutoCropOption, expectedWidth, expectedHeight int) {
 	// Run Filter
-	result := NewAutoCropFilter(option).Run(NewFilterSource(img, "filename", 0))
+	result, err := NewAutoCropFilter(option).Run(NewFilterSource(img, "filename", 0))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
 
 	// Test result image size
 	destBounds := result.Img().Bounds()
@@ -125,3 +128,138 @@ func TestAutoCropMaxCrop(t *testing.T) {
 		310, // max(height - bottomSpace + marginBottom, height * maxHeightCropRate)
 	)
 }
+
+func TestAutoCropUniform(t *testing.T) {
+	img1 := CreateImage(200, 350, color.White)
+	FillRect(img1, 50, 50, 150, 300, color.Black)
+	img2 := CreateImage(200, 350, color.White)
+	FillRect(img2, 40, 100, 120, 320, color.Black)
+	blank := CreateImage(200, 350, color.White)
+
+	filter := NewAutoCropFilter(AutoCropOption{
+		Threshold: 128,
+		MinRatio:  1.0, MaxRatio: 3.0,
+		MaxWidthCropRate: 0.5, MaxHeightCropRate: 0.5,
+		UniformCrop: UniformCropBook,
+	})
+	if !filter.NeedsAnalysis() {
+		t.Fatalf("uniform crop needs analysis")
+	}
+
+	for i, img := range []image.Image{img1, img2, blank} {
+		filter.Analyze(NewFilterSource(img, "filename", i))
+	}
+	filter.EndAnalysis()
+
+	for i, img := range []image.Image{img1, img2} {
+		result, err := filter.Run(NewFilterSource(img, "filename", i))
+		if err != nil {
+			t.Fatalf("filter failed : %v", err)
+		}
+		if rect := result.(AutoCropResult).rect; rect != image.Rect(40, 50, 150, 320) {
+			t.Errorf("crop rect mismatch. index=%v, actual=%v", i, rect)
+		}
+	}
+}
+
+func TestAutoCropUniformOutlier(t *testing.T) {
+	page := CreateImage(200, 350, color.White)
+	FillRect(page, 50, 50, 150, 300, color.Black)
+	cover := CreateImage(200, 350, color.Black)
+
+	filter := NewAutoCropFilter(AutoCropOption{
+		Threshold: 128,
+		MinRatio:  1.0, MaxRatio: 3.0,
+		MaxWidthCropRate: 0.5, MaxHeightCropRate: 0.5,
+		UniformCrop: UniformCropBook,
+	})
+
+	// a full-bleed cover in 10 pages does not widen the crop box
+	filter.Analyze(NewFilterSource(cover, "filename", 0))
+	for i := 1; i < 10; i++ {
+		filter.Analyze(NewFilterSource(page, "filename", i))
+	}
+	filter.EndAnalysis()
+
+	result, err := filter.Run(NewFilterSource(page, "filename", 1))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
+	if rect := result.(AutoCropResult).rect; rect != image.Rect(50, 50, 150, 300) {
+		t.Errorf("crop rect mismatch. actual=%v", rect)
+	}
+}
+
+func TestAutoCropUniformLockedThreshold(t *testing.T) {
+	// the light grey area is content by the threshold of its own page only
+	grey := CreateImage(200, 350, color.White)
+	FillRect(grey, 10, 10, 190, 340, color.Gray{200})
+	page := CreateImage(200, 350, color.White)
+	FillRect(page, 50, 50, 150, 300, color.Black)
+
+	pipeline := NewPipeline(AbortOnError)
+	pipeline.AddFilter("autoCrop", NewAutoCropFilter(AutoCropOption{
+		AutoThreshold: true, LockThreshold: true,
+		MinRatio: 1.0, MaxRatio: 3.0,
+		MaxWidthCropRate: 0.5, MaxHeightCropRate: 0.5,
+		UniformCrop: UniformCropBook,
+	}), nil)
+
+	images := []image.Image{grey, page, page}
+	passes := 0
+	for pipeline.NeedsAnalysis() {
+		for i, img := range images {
+			pipeline.Analyze(img, "filename", i)
+		}
+		pipeline.EndAnalysis()
+		passes++
+	}
+	if passes != 2 {
+		t.Errorf("analysis pass count mismatch. expected=2, actual=%v", passes)
+	}
+
+	if _, err := pipeline.Run(page, "filename", 1); err != nil {
+		t.Fatalf("pipeline failed : %v", err)
+	}
+	if rect := pipeline.Report().Pages()[0].CropRect; rect == nil || *rect != (ReportRect{50, 50, 150, 300}) {
+		t.Errorf("crop rect mismatch. actual=%v", rect)
+	}
+}
+
+func TestAutoCropUniformOddEven(t *testing.T) {
+	img1 := CreateImage(200, 350, color.White)
+	FillRect(img1, 50, 50, 150, 300, color.Black)
+	img2 := CreateImage(200, 350, color.White)
+	FillRect(img2, 40, 100, 120, 320, color.Black)
+
+	filter := NewAutoCropFilter(AutoCropOption{
+		Threshold: 128,
+		MinRatio:  1.0, MaxRatio: 3.0,
+		MaxWidthCropRate: 0.5, MaxHeightCropRate: 0.5,
+		MaxCropTop: 60, MaxCropBottom: -1, MaxCropLeft: -1, MaxCropRight: -1,
+		UniformCrop: UniformCropOddEven,
+	})
+
+	images := []image.Image{img1, img2, img1, img2}
+	for i, img := range images {
+		filter.Analyze(NewFilterSource(img, "filename", i))
+	}
+	filter.EndAnalysis()
+
+	expected := []image.Rectangle{
+		image.Rect(50, 50, 150, 300),
+		image.Rect(30, 60, 130, 320), // width is limited by maxWidthCropRate
+	}
+	for i, img := range images {
+		result, _ := filter.Run(NewFilterSource(img, "filename", i))
+		if rect := result.(AutoCropResult).rect; rect != expected[i%2] {
+			t.Errorf("crop rect mismatch. index=%v, expected=%v, actual=%v", i, expected[i%2], rect)
+		}
+	}
+}
+
+func TestAutoCropInvalidUniform(t *testing.T) {
+	if _, err := NewAutoCropOption(map[string]interface{}{"uniformCrop": "chapter"}); err == nil {
+		t.Errorf("error expected for invalid uniformCrop")
+	}
+}
@@ -0,0 +1,251 @@
+package lecimg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// binarize methods
+const (
+	BinarizeGlobal  = "global"
+	BinarizeSauvola = "sauvola"
+	BinarizeNiblack = "niblack"
+)
+
+// default values of BinarizeOption
+const (
+	defaultBinarizeWindowSize = 25
+	defaultSauvolaK           = 0.2
+	defaultNiblackK           = -0.2
+	defaultSauvolaR           = 128
+	defaultNiblackDeviation   = 10
+)
+
+type BinarizeOption struct {
+	Method        string  // "global", "sauvola"(default) or "niblack"
+	Threshold     uint8   // min brightness of white dots for global method (0~255, default: auto)
+	AutoThreshold bool    // selects Threshold of each page by Otsu's method ("threshold: auto")
+	LockThreshold bool    // uses one auto threshold for the book
+	WindowSize    int     // local window width and height in pixels for sauvola and niblack (default: 25)
+	K             float64 // sensitivity (default: sauvola 0.2, niblack -0.2)
+	R             float64 // dynamic range of standard deviation for sauvola (default: 128)
+	MinDeviation  float64 // in windows with lower standard deviation, niblack keeps only dots darker than mean - value (default: 10)
+}
+
+func NewBinarizeOption(m map[string]interface{}) (*BinarizeOption, error) {
+	option := BinarizeOption{}
+
+	m, auto := parseAutoThreshold(m)
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+	option.AutoThreshold = option.AutoThreshold || auto
+
+	switch option.Method {
+	case "":
+		option.Method = BinarizeSauvola
+	case BinarizeGlobal, BinarizeSauvola, BinarizeNiblack:
+	default:
+		return nil, fmt.Errorf("invalid binarize method : %v", option.Method)
+	}
+	if option.WindowSize < 0 {
+		return nil, fmt.Errorf("invalid windowSize : %v", option.WindowSize)
+	}
+
+	return &option, nil
+}
+
+type BinarizeResult struct {
+	thresholdResult
+	image *image.Gray
+}
+
+func (r BinarizeResult) Img() image.Image {
+	return r.image
+}
+
+func (r BinarizeResult) Log() {
+	r.logThreshold()
+}
+
+func (r BinarizeResult) Report(report *PageReport) {
+	r.reportThreshold(report)
+}
+
+// ----------------------------------------------------------------------------
+
+// BinarizeFilter converts a page to black and white.
+// The result is an *image.Gray so that writers store a single channel.
+type BinarizeFilter struct {
+	autoThresholdFilter
+	option BinarizeOption
+}
+
+func NewBinarizeFilter(option BinarizeOption) *BinarizeFilter {
+	if option.Method == "" {
+		option.Method = BinarizeSauvola
+	}
+	if option.WindowSize == 0 {
+		option.WindowSize = defaultBinarizeWindowSize
+	}
+	if option.K == 0 {
+		if option.Method == BinarizeNiblack {
+			option.K = defaultNiblackK
+		} else {
+			option.K = defaultSauvolaK
+		}
+	}
+	if option.R == 0 {
+		option.R = defaultSauvolaR
+	}
+	if option.MinDeviation == 0 {
+		option.MinDeviation = defaultNiblackDeviation
+	}
+	// no dot is darker than threshold 0, so the page would be white
+	if option.Method == BinarizeGlobal && option.Threshold == 0 {
+		option.AutoThreshold = true
+	}
+
+	auto := option.Method == BinarizeGlobal && option.AutoThreshold
+	return &BinarizeFilter{
+		option:              option,
+		autoThresholdFilter: autoThresholdFilter{newAutoThreshold(auto, option.LockThreshold)},
+	}
+}
+
+func init() {
+	RegisterFilter("binarize", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewBinarizeOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewBinarizeFilter(*option), nil
+	})
+}
+
+// Implements Filter.Run()
+func (f BinarizeFilter) Run(s *FilterSource) (FilterResult, error) {
+	gray := grayImage(s.image)
+
+	switch f.option.Method {
+	case BinarizeGlobal:
+		if f.threshold.enabled() {
+			f.option.Threshold = f.threshold.get(gray)
+		}
+		binarizeGlobal(gray, f.option.Threshold)
+	case BinarizeSauvola, BinarizeNiblack:
+		f.binarizeLocal(gray)
+	default:
+		return nil, fmt.Errorf("invalid binarize method : %v", f.option.Method)
+	}
+
+	return BinarizeResult{
+		thresholdResult{s.filename, f.threshold.enabled(), f.option.Threshold},
+		gray,
+	}, nil
+}
+
+// grayImage converts the image to gray with the same brightness
+// as detection filters use.
+func grayImage(src image.Image) *image.Gray {
+	bounds := src.Bounds()
+	dest := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := src.At(x, y).RGBA()
+			dest.SetGray(x, y, color.Gray{uint8(getBrightness(r, g, b) >> 8)})
+		}
+	}
+	return dest
+}
+
+// binarizeGlobal makes dots darker than threshold black and others white.
+func binarizeGlobal(img *image.Gray, threshold uint8) {
+	for i, v := range img.Pix {
+		if v < threshold {
+			img.Pix[i] = 0
+		} else {
+			img.Pix[i] = 255
+		}
+	}
+}
+
+// binarizeLocal uses the mean and the standard deviation of the window
+// around each dot so that uneven lighting does not affect the result.
+func (f BinarizeFilter) binarizeLocal(img *image.Gray) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	sums, squares := integralImages(img)
+
+	half := f.option.WindowSize / 2
+	k, r, minDeviation := f.option.K, f.option.R, f.option.MinDeviation
+	sauvola := f.option.Method == BinarizeSauvola
+
+	// thresholds are calculated from the original values before writing
+	out := make([]uint8, width*height)
+	for y := 0; y < height; y++ {
+		y1, y2 := Max(0, y-half), Min(height, y+half+1)
+		for x := 0; x < width; x++ {
+			x1, x2 := Max(0, x-half), Min(width, x+half+1)
+			count := float64((x2 - x1) * (y2 - y1))
+			sum := float64(integralSum(sums, width, x1, y1, x2, y2))
+			square := float64(integralSum(squares, width, x1, y1, x2, y2))
+
+			mean := sum / count
+			deviation := math.Sqrt(math.Max(0, square/count-mean*mean))
+
+			var threshold float64
+			if sauvola {
+				threshold = mean * (1 + k*(deviation/r-1))
+			} else if deviation < minDeviation {
+				// niblack turns noise of blank area into dots
+				threshold = mean - minDeviation
+			} else {
+				threshold = mean + k*deviation
+			}
+
+			if float64(img.Pix[y*img.Stride+x]) < threshold {
+				out[y*width+x] = 0
+			} else {
+				out[y*width+x] = 255
+			}
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		copy(img.Pix[y*img.Stride:y*img.Stride+width], out[y*width:(y+1)*width])
+	}
+}
+
+// integralImages returns summed-area tables of values and squared values.
+// Tables have (width+1)*(height+1) entries with zero first row and column.
+func integralImages(img *image.Gray) ([]int64, []int64) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	stride := width + 1
+
+	sums := make([]int64, stride*(height+1))
+	squares := make([]int64, stride*(height+1))
+	for y := 0; y < height; y++ {
+		var rowSum, rowSquare int64
+		for x := 0; x < width; x++ {
+			v := int64(img.Pix[y*img.Stride+x])
+			rowSum += v
+			rowSquare += v * v
+			sums[(y+1)*stride+x+1] = sums[y*stride+x+1] + rowSum
+			squares[(y+1)*stride+x+1] = squares[y*stride+x+1] + rowSquare
+		}
+	}
+	return sums, squares
+}
+
+// integralSum returns the sum of values in [x1, x2) x [y1, y2).
+func integralSum(table []int64, width, x1, y1, x2, y2 int) int64 {
+	stride := width + 1
+	return table[y2*stride+x2] - table[y1*stride+x2] - table[y2*stride+x1] + table[y1*stride+x1]
+}
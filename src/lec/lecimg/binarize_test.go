@@ -0,0 +1,70 @@
+package lecimg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// newUnevenPage creates a page whose background gets darker from left to right
+// with a thick block and a thin vertical stroke on both sides.
+func newUnevenPage() *image.RGBA {
+	img := CreateImage(200, 100, color.White)
+	for x := 0; x < 200; x++ {
+		v := uint8(250 - x/2)
+		DrawLine(img, x, 0, x, 100, color.Gray{v})
+	}
+	FillRect(img, 20, 40, 40, 60, color.Gray{60})
+	DrawLine(img, 60, 30, 60, 70, color.Gray{110})
+	FillRect(img, 160, 40, 180, 60, color.Gray{40})
+	DrawLine(img, 140, 30, 140, 70, color.Gray{70})
+	return img
+}
+
+func testBinarize(t *testing.T, option BinarizeOption) {
+	result := runTestFilter(t, NewBinarizeFilter(option), newUnevenPage())
+	gray, ok := result.Img().(*image.Gray)
+	if !ok {
+		t.Fatalf("gray image expected. actual=%T", result.Img())
+	}
+
+	for _, p := range []image.Point{{30, 50}, {60, 50}, {170, 50}, {140, 50}} {
+		if v := gray.GrayAt(p.X, p.Y).Y; v != 0 {
+			t.Errorf("%v : black expected at %v. actual=%v", option.Method, p, v)
+		}
+	}
+	for _, p := range []image.Point{{5, 5}, {100, 50}, {195, 95}} {
+		if v := gray.GrayAt(p.X, p.Y).Y; v != 255 {
+			t.Errorf("%v : white expected at %v. actual=%v", option.Method, p, v)
+		}
+	}
+}
+
+func TestBinarizeSauvola(t *testing.T) {
+	testBinarize(t, BinarizeOption{Method: BinarizeSauvola})
+}
+
+func TestBinarizeNiblack(t *testing.T) {
+	testBinarize(t, BinarizeOption{Method: BinarizeNiblack, WindowSize: 31, K: -0.2})
+}
+
+func TestBinarizeGlobal(t *testing.T) {
+	img := CreateImage(100, 100, color.Gray{200})
+	FillRect(img, 20, 20, 80, 40, color.Gray{50})
+
+	// threshold is selected automatically unless it is given
+	for _, option := range []BinarizeOption{{Method: BinarizeGlobal, AutoThreshold: true}, {Method: BinarizeGlobal}} {
+		result := runTestFilter(t, NewBinarizeFilter(option), img)
+		gray := result.Img().(*image.Gray)
+		if gray.GrayAt(30, 30).Y != 0 || gray.GrayAt(5, 5).Y != 255 {
+			t.Errorf("global binarization failed. option=%+v", option)
+		}
+	}
+}
+
+func TestResizeGrayImage(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 100, 100))
+	if _, ok := ResizeImage(img, 50, 50, true).(*image.Gray); !ok {
+		t.Errorf("gray image should be kept")
+	}
+}
@@ -1,6 +1,7 @@
 package lecimg
 
 import (
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
@@ -11,32 +12,72 @@ import (
 	"github.com/mitchellh/mapstructure"
 )
 
+// text orientations of ChangeLineSpaceFilter
+const (
+	TextOrientationHorizontal = "horizontal"
+	TextOrientationVertical   = "vertical"
+	TextOrientationAuto       = "auto"
+)
+
+// default values of ChangeLineSpaceOption
+const (
+	defaultLineSpaceFigureRate  = 3
+	defaultLineSpaceMinRuleRate = 0.5
+)
+
 // ChangeLineSpaceOption contains options for changeLineSpace filter
 type ChangeLineSpaceOption struct {
 	WidthRatio         float64
 	HeightRatio        float64
+	Orientation        string // "horizontal"(default), "vertical" : columns of vertical writing, "auto" : detects each page
 	LineSpaceScale     float64
 	MinSpace           int
 	MaxRemove          int
 	Threshold          uint32
+	AutoThreshold      bool // selects Threshold of each page by Otsu's method ("threshold: auto")
+	LockThreshold      bool // uses one auto threshold for the book
 	EmptyLineThreshold float64
+	ProtectFigures     bool    // copies figures, tables and halftone areas without resizing
+	FigureRate         float64 // blocks taller than the text line height times value are figures (default: 3)
+	MinRuleRate        float64 // min length of horizontal rules of tables as rate of the width (default: 0.5)
 	DebugMode          bool
+	DebugOutputDir     string         // writes annotated images if not empty
+	Flatten            *FlattenOption // flattens lighting for line detection without changing output
 }
 
 func NewChangeLineSpaceOption(m map[string]interface{}) (*ChangeLineSpaceOption, error) {
 	option := ChangeLineSpaceOption{}
 
+	m, auto := parseAutoThreshold(m)
 	err := mapstructure.Decode(m, &option)
 	if err != nil {
 		return nil, err
 	}
+	option.AutoThreshold = option.AutoThreshold || auto
+	switch option.Orientation {
+	case "", TextOrientationHorizontal, TextOrientationVertical, TextOrientationAuto:
+	default:
+		return nil, fmt.Errorf("invalid orientation : %v", option.Orientation)
+	}
+	if option.FigureRate < 0 || option.MinRuleRate < 0 || option.MinRuleRate > 1 {
+		return nil, fmt.Errorf("invalid figureRate or minRuleRate : figureRate=%v, minRuleRate=%v",
+			option.FigureRate, option.MinRuleRate)
+	}
+	if option.Flatten != nil {
+		if err := option.Flatten.validate(); err != nil {
+			return nil, err
+		}
+	}
 
 	return &option, nil
 }
 
 type ChangeLineSpaceResult struct {
-	image image.Image
-	rect  image.Rectangle
+	thresholdResult
+	image    image.Image
+	rect     image.Rectangle
+	ranges   lineRanges
+	vertical bool // line ranges are columns of vertical text
 }
 
 func (r ChangeLineSpaceResult) Img() image.Image {
@@ -44,6 +85,22 @@ func (r ChangeLineSpaceResult) Img() image.Image {
 }
 
 func (r ChangeLineSpaceResult) Log() {
+	r.logThreshold()
+	if r.vertical {
+		log.Printf("[LINESPACE] %v : vertical text\n", r.filename)
+	}
+}
+
+// Report adds the number of changed line ranges to the page report.
+func (r ChangeLineSpaceResult) Report(report *PageReport) {
+	changed := 0
+	for _, lineRange := range r.ranges {
+		if lineRange.targetHeight != lineRange.height {
+			changed++
+		}
+	}
+	report.LineSpaceRanges = changed
+	r.reportThreshold(report)
 }
 
 // ----------------------------------------------------------------------------
@@ -54,11 +111,12 @@ type lineRange struct {
 	height       int
 	targetHeight int
 	emptyLine    bool
+	protected    bool // part of a figure which keeps its height
 }
 
 func (r *lineRange) calc(scale float64, minHeight, maxRemove int) {
 	r.height = r.end - r.start + 1
-	if !r.emptyLine || r.height <= minHeight {
+	if !r.emptyLine || r.protected || r.height <= minHeight {
 		r.targetHeight = r.height
 	} else {
 		if maxRemove > 0 {
@@ -75,8 +133,8 @@ func (r lineRange) getReducedHeight() int {
 }
 
 func (r lineRange) String() string {
-	return fmt.Sprintf("(%4d-%4d) h:%d, targetH: %d, empty: %v",
-		r.start, r.end, r.height, r.targetHeight, r.emptyLine)
+	return fmt.Sprintf("(%4d-%4d) h:%d, targetH: %d, empty: %v, protected: %v",
+		r.start, r.end, r.height, r.targetHeight, r.emptyLine, r.protected)
 }
 
 type lineRanges []lineRange
@@ -96,11 +154,32 @@ func (r lineRanges) Swap(i, j int) {
 // ----------------------------------------------------------------------------
 
 type ChangeLineSpaceFilter struct {
-	option ChangeLineSpaceOption
+	autoThresholdFilter
+	option   ChangeLineSpaceOption
+	vertical bool // the page is turned for vertical text while running
 }
 
 func NewChangeLineSpaceFilter(option ChangeLineSpaceOption) *ChangeLineSpaceFilter {
-	return &ChangeLineSpaceFilter{option: option}
+	if option.FigureRate == 0 {
+		option.FigureRate = defaultLineSpaceFigureRate
+	}
+	if option.MinRuleRate == 0 {
+		option.MinRuleRate = defaultLineSpaceMinRuleRate
+	}
+	return &ChangeLineSpaceFilter{
+		option:              option,
+		autoThresholdFilter: autoThresholdFilter{newAutoThreshold(option.AutoThreshold, option.LockThreshold)},
+	}
+}
+
+func init() {
+	RegisterFilter("changeLineSpace", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewChangeLineSpaceOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewChangeLineSpaceFilter(*option), nil
+	})
 }
 
 func getBrightness(r, g, b uint32) uint32 {
@@ -109,22 +188,29 @@ func getBrightness(r, g, b uint32) uint32 {
 
 // getLineRanges returns list of text and empty lines
 func (f ChangeLineSpaceFilter) getLineRanges(src image.Image) lineRanges {
+	return findLineRanges(src, f.option.Threshold, f.option.EmptyLineThreshold)
+}
+
+// findLineRanges returns list of text and empty lines.
+// Lines with fewer dots darker than threshold than emptyLineThreshold are empty.
+// emptyLineThreshold less than 1 is a rate of the width.
+func findLineRanges(src image.Image, threshold uint32, emptyLineThreshold float64) lineRanges {
 	bounds := src.Bounds()
 	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
-	threshold16 := f.option.Threshold * 256
+	threshold16 := threshold * 256
 
 	var ranges lineRanges
 	var r lineRange
 
-	maxDotCount := int(f.option.EmptyLineThreshold)
-	if f.option.EmptyLineThreshold < 1 {
-		maxDotCount = int(float64(srcWidth) * f.option.EmptyLineThreshold)
+	maxDotCount := int(emptyLineThreshold)
+	if emptyLineThreshold < 1 {
+		maxDotCount = int(float64(srcWidth) * emptyLineThreshold)
 	}
 	for y := 0; y < srcHeight; y++ {
 		emptyLine := true
 		dotCount := 0
 		for x := 0; x < srcWidth; x++ {
-			r, g, b, _ := src.At(x, y).RGBA()
+			r, g, b, _ := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
 			brightness := getBrightness(r, g, b)
 			if brightness < threshold16 {
 				dotCount++
@@ -164,6 +250,172 @@ func (f ChangeLineSpaceFilter) getLineRanges(src image.Image) lineRanges {
 	return ranges
 }
 
+// protectFigures splits line ranges at the edges of figures, tables and
+// halftone areas and marks the ranges inside them protected.
+func (f ChangeLineSpaceFilter) protectFigures(src image.Image, ranges lineRanges) lineRanges {
+	figures := f.findFigures(src, ranges)
+	if len(figures) == 0 {
+		return ranges
+	}
+
+	var dest lineRanges
+	for _, r := range ranges {
+		for start := r.start; start <= r.end; {
+			end, protected := r.end, false
+			for _, figure := range figures {
+				if start >= figure.start && start < figure.end {
+					end, protected = Min(end, figure.end-1), true
+				} else if figure.start > start {
+					end = Min(end, figure.start-1)
+				}
+			}
+			dest = append(dest, lineRange{start: start, end: end, emptyLine: r.emptyLine, protected: protected})
+			start = end + 1
+		}
+	}
+	return dest
+}
+
+// findFigures returns sorted spans of y which have non-text blocks:
+//   - connected dark areas taller than FigureRate times the text line height,
+//     such as diagrams, framed photos and vertical rules of tables
+//   - areas between horizontal rules closer than the figure height, as in tables
+//   - runs of thin lines as in halftone dots of photos
+func (f ChangeLineSpaceFilter) findFigures(src image.Image, ranges lineRanges) []span {
+	// text line height is the median weighted by the height,
+	// so that thin lines of halftone areas do not lower it
+	var heights []int
+	total := 0
+	for _, r := range ranges {
+		if !r.emptyLine {
+			heights = append(heights, r.end-r.start+1)
+			total += r.end - r.start + 1
+		}
+	}
+	if len(heights) == 0 {
+		return nil
+	}
+	sort.Ints(heights)
+	lineHeight := 0
+	for sum, i := 0, 0; sum*2 < total; i++ {
+		lineHeight = heights[i]
+		sum += heights[i]
+	}
+	figureHeight := Max(2, int(float64(lineHeight)*f.option.FigureRate))
+	thinHeight := Max(1, lineHeight/3)
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	threshold16 := f.option.Threshold * 256
+	dark := make([]bool, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			dark[y*width+x] = getBrightness(r, g, b) < threshold16
+		}
+	}
+
+	var figures []span
+
+	// tall connected areas
+	visited := make([]bool, width*height)
+	var stack []int
+	for start := range dark {
+		if !dark[start] || visited[start] {
+			continue
+		}
+		top, bottom := start/width, start/width
+		visited[start] = true
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := i%width, i/width
+			top, bottom = Min(top, y), Max(bottom, y)
+			for ny := Max(0, y-1); ny <= Min(height-1, y+1); ny++ {
+				for nx := Max(0, x-1); nx <= Min(width-1, x+1); nx++ {
+					if n := ny*width + nx; dark[n] && !visited[n] {
+						visited[n] = true
+						stack = append(stack, n)
+					}
+				}
+			}
+		}
+		if bottom+1-top >= figureHeight {
+			figures = append(figures, span{top, bottom + 1})
+		}
+	}
+
+	// tables of horizontal rules
+	minRule := Max(1, int(float64(width)*f.option.MinRuleRate))
+	var table span
+	rules, lastRule := 0, -1
+	for y := 0; y < height; y++ {
+		run, longest := 0, 0
+		for x := 0; x < width; x++ {
+			if dark[y*width+x] {
+				run++
+				longest = Max(longest, run)
+			} else {
+				run = 0
+			}
+		}
+		if longest < minRule {
+			continue
+		}
+		if rules > 0 && y-lastRule-1 <= figureHeight {
+			if y > lastRule+1 {
+				rules++
+			}
+		} else {
+			if rules >= 2 {
+				figures = append(figures, table)
+			}
+			table, rules = span{y, y}, 1
+		}
+		table.end, lastRule = y+1, y
+	}
+	if rules >= 2 {
+		figures = append(figures, table)
+	}
+
+	// halftone areas
+	thin := span{-1, -1}
+	count := 0
+	for _, r := range ranges {
+		switch {
+		case r.end-r.start+1 > thinHeight:
+			if count >= 4 {
+				figures = append(figures, thin)
+			}
+			count = 0
+		case !r.emptyLine:
+			if count == 0 {
+				thin.start = r.start
+			}
+			thin.end = r.end + 1
+			count++
+		}
+	}
+	if count >= 4 {
+		figures = append(figures, thin)
+	}
+
+	// merge overlapping spans
+	sort.Slice(figures, func(i, j int) bool {
+		return figures[i].start < figures[j].start
+	})
+	var merged []span
+	for _, figure := range figures {
+		if n := len(merged); n > 0 && figure.start <= merged[n-1].end {
+			merged[n-1].end = Max(merged[n-1].end, figure.end)
+		} else {
+			merged = append(merged, figure)
+		}
+	}
+	return merged
+}
+
 func (f ChangeLineSpaceFilter) processLineRanges(ranges lineRanges, width int) int {
 	targetHeight := 0
 	rangeCount := len(ranges)
@@ -172,7 +424,7 @@ func (f ChangeLineSpaceFilter) processLineRanges(ranges lineRanges, width int) i
 		r := &ranges[i]
 		r.calc(f.option.LineSpaceScale, f.option.MinSpace, f.option.MaxRemove)
 		targetHeight += r.targetHeight
-		if r.emptyLine {
+		if r.emptyLine && !r.protected {
 			emptyRangeCount++
 		}
 	}
@@ -227,7 +479,7 @@ func (f ChangeLineSpaceFilter) processLineRanges(ranges lineRanges, width int) i
 				copy(sortedRanges, ranges)
 				sort.Sort(sortedRanges)
 				for i := 0; i < rangeCount && remainInc != 0; i++ {
-					if r := sortedRanges[i]; r.emptyLine {
+					if r := sortedRanges[i]; r.emptyLine && !r.protected {
 						if remainInc > 0 {
 							r.targetHeight++
 							targetHeight++
@@ -250,20 +502,69 @@ func (f ChangeLineSpaceFilter) processLineRanges(ranges lineRanges, width int) i
 	return targetHeight
 }
 
-func (f ChangeLineSpaceFilter) Run(s *FilterSource) FilterResult {
-	img, rect := f.run(s.image)
-	return &ChangeLineSpaceResult{img, rect}
+func (f ChangeLineSpaceFilter) Run(s *FilterSource) (FilterResult, error) {
+	f.option.DebugOutputDir = s.debugOutputDir(f.option.DebugOutputDir)
+	if f.option.WidthRatio <= 0 || f.option.HeightRatio <= 0 {
+		return nil, errors.New("widthRatio and heightRatio should be positive")
+	}
+
+	detect := flattenedImage(s.image, f.option.Flatten)
+	if f.threshold.enabled() {
+		f.option.Threshold = uint32(f.threshold.get(detect))
+	}
+	threshold := thresholdResult{s.filename, f.threshold.enabled(), uint8(f.option.Threshold)}
+
+	switch f.option.Orientation {
+	case TextOrientationVertical:
+		f.vertical = true
+	case TextOrientationAuto:
+		f.vertical = isVerticalText(detect, uint8(f.option.Threshold))
+	}
+	if !f.vertical {
+		img, rect, ranges := f.run(s.image, detect, s.filename)
+		return &ChangeLineSpaceResult{threshold, img, rect, ranges, false}, nil
+	}
+
+	// columns of vertical text are turned into lines, and the width of the
+	// page is fitted to the device aspect ratio instead of the height.
+	f.option.WidthRatio, f.option.HeightRatio = f.option.HeightRatio, f.option.WidthRatio
+	img, _, ranges := f.run(RotateImage90(s.image, 90), RotateImage90(detect, 90), s.filename)
+	img = RotateImage90(img, 270)
+	return &ChangeLineSpaceResult{threshold, img, img.Bounds(), ranges, true}, nil
+}
+
+// isVerticalText returns true if dark dots of the page are concentrated in
+// columns rather than rows, as in columns of vertical writing.
+func isVerticalText(src image.Image, threshold uint8) bool {
+	rows, columns := projectionProfiles(src, threshold)
+	return profileEnergy(columns) > profileEnergy(rows)
+}
+
+// Implements BookFilter.Analyze()
+func (f ChangeLineSpaceFilter) Analyze(s *FilterSource) error {
+	f.threshold.add(flattenedImage(s.image, f.option.Flatten))
+	return nil
 }
 
-func (f ChangeLineSpaceFilter) run(src image.Image) (image.Image, image.Rectangle) {
-	ranges := f.getLineRanges(src)
+// run detects line ranges in detect and changes the space of src.
+func (f ChangeLineSpaceFilter) run(src, detect image.Image, filename string) (image.Image, image.Rectangle, lineRanges) {
+	ranges := f.getLineRanges(detect)
+	if f.option.ProtectFigures {
+		ranges = f.protectFigures(detect, ranges)
+	}
 	rangeCount := len(ranges)
 
 	if rangeCount <= 1 {
-		return src, src.Bounds()
+		if f.option.DebugOutputDir != "" {
+			f.saveDebugImage(src, filename, ranges, src.Bounds().Dy())
+		}
+		return src, src.Bounds(), nil
 	} else {
 		width := src.Bounds().Dx()
 		targetHeight := f.processLineRanges(ranges, width)
+		if f.option.DebugOutputDir != "" {
+			f.saveDebugImage(src, filename, ranges, targetHeight)
+		}
 
 		bounds := image.Rect(0, 0, width, targetHeight)
 		dest := CreateImage(width, targetHeight, color.White)
@@ -293,6 +594,38 @@ func (f ChangeLineSpaceFilter) run(src image.Image) (image.Image, image.Rectangl
 				destY += rangeTargetHeight
 			}
 		}
-		return dest, bounds
+		return dest, bounds, ranges
 	}
 }
+
+// saveDebugImage writes the source image with empty and text line ranges colour-coded.
+func (f ChangeLineSpaceFilter) saveDebugImage(src image.Image, filename string, ranges lineRanges, targetHeight int) {
+	img := newDebugImage(src)
+	width := img.Bounds().Dx()
+	barWidth := 8
+
+	for _, r := range ranges {
+		rect := image.Rect(0, r.start, width, r.end+1)
+		if r.protected {
+			BlendRect(img, rect, debugFigureColor)
+			FillRect(img, 0, r.start, barWidth, r.end+1, debugContentColor)
+		} else if r.emptyLine {
+			BlendRect(img, rect, debugEmptyColor)
+			FillRect(img, 0, r.start, barWidth, r.end+1, color.RGBA{255, 160, 0, 255})
+		} else {
+			BlendRect(img, rect, debugLineColor)
+			FillRect(img, 0, r.start, barWidth, r.end+1, color.RGBA{0, 160, 255, 255})
+		}
+		if r.targetHeight != r.height {
+			DrawLabelBold8x16(img, barWidth+2, r.end+1, fmt.Sprintf("%d->%d", r.height, r.targetHeight), debugTextColor)
+		}
+	}
+	label := fmt.Sprintf("ranges: %v, height: %v->%v", len(ranges), img.Bounds().Dy(), targetHeight)
+	if f.vertical {
+		img = rgbaImage(RotateImage90(img, 270))
+		label = fmt.Sprintf("ranges: %v, width: %v->%v", len(ranges), img.Bounds().Dx(), targetHeight)
+	}
+
+	drawDebugLabels(img, []string{label})
+	saveDebugImage(img, f.option.DebugOutputDir, filename, "changeLineSpace")
+}
@@ -3,12 +3,19 @@ package lecimg
 import (
 	"image"
 	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
 func testChangeLineSpace(t *testing.T, img image.Image, option ChangeLineSpaceOption, expectedHeight int) {
 	// Run Filter
-	result := NewChangeLineSpaceFilter(option).Run(NewFilterSource(img, "filename", 0))
+	result, err := NewChangeLineSpaceFilter(option).Run(NewFilterSource(img, "filename", 0))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
 
 	// Test result image size
 	destBounds := result.Img().Bounds()
@@ -55,3 +62,156 @@ func TestChangeLineSpaceVerticalLine(t *testing.T) {
 	}
 	testChangeLineSpace(t, img, opt, int(opt.HeightRatio))
 }
+
+func TestChangeLineSpaceDebugImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img := CreateImage(100, 300, color.White)
+	FillRect(img, 50, 20, 80, 50, color.Black)
+	FillRect(img, 30, 180, 70, 200, color.Black)
+
+	opt := ChangeLineSpaceOption{
+		WidthRatio:     100,
+		HeightRatio:    200,
+		LineSpaceScale: 0.1,
+		MinSpace:       1,
+		MaxRemove:      9999,
+		Threshold:      180,
+		DebugOutputDir: dir,
+	}
+	if _, err := NewChangeLineSpaceFilter(opt).Run(NewFilterSource(img, "Page.jpg", 0)); err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "page.changeLineSpace.png")); err != nil {
+		t.Errorf("debug image not found : %v", err)
+	}
+}
+
+// createFiguresPage draws text lines of words, a framed figure, a table of rules,
+// halftone dots and text lines again.
+func createFiguresPage() *image.RGBA {
+	img := CreateImage(200, 480, color.White)
+	drawLine := func(y int) {
+		for x := 20; x < 180; x += 40 {
+			FillRect(img, x, y, x+30, y+10, color.Black)
+		}
+	}
+	drawLine(20)
+	drawLine(40)
+	drawLine(60)
+	DrawRect(img, image.Rect(20, 100, 180, 160), color.Black) // figure
+	for _, y := range []int{200, 230, 260} {
+		FillRect(img, 10, y, 190, y+1, color.Black) // table rules
+	}
+	drawLine(210)
+	drawLine(240)
+	for y := 300; y < 380; y += 4 {
+		for x := 20; x < 180; x += 4 {
+			FillRect(img, x, y, x+2, y+2, color.Black) // halftone
+		}
+	}
+	drawLine(420)
+	drawLine(440)
+	return img
+}
+
+func TestChangeLineSpaceProtectFigures(t *testing.T) {
+	opt := ChangeLineSpaceOption{
+		WidthRatio:         200,
+		HeightRatio:        100,
+		LineSpaceScale:     0.1,
+		MinSpace:           1,
+		MaxRemove:          9999,
+		Threshold:          180,
+		EmptyLineThreshold: 4,
+		ProtectFigures:     true,
+	}
+	result, err := NewChangeLineSpaceFilter(opt).Run(NewFilterSource(createFiguresPage(), "filename", 0))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
+
+	figures := []span{{100, 160}, {200, 261}, {300, 378}}
+	for _, r := range result.(*ChangeLineSpaceResult).ranges {
+		inFigure := false
+		for _, figure := range figures {
+			if r.start >= figure.start && r.end < figure.end {
+				inFigure = true
+			}
+		}
+		if inFigure && (!r.protected || r.targetHeight != r.height) {
+			t.Errorf("range in a figure should be kept : %v", r)
+		}
+		if !inFigure && r.protected {
+			t.Errorf("range out of figures should not be protected : %v", r)
+		}
+	}
+
+	// the frame of the figure keeps its height
+	img := result.Img()
+	longest, run := 0, 0
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		if isDark(img, 20, y) {
+			run++
+			longest = Max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	if longest != 60 {
+		t.Errorf("figure height mismatch. expected=60, actual=%v", longest)
+	}
+}
+
+func TestChangeLineSpaceVerticalText(t *testing.T) {
+	// columns of vertical text, from right to left
+	img := CreateImage(300, 100, color.White)
+	FillRect(img, 250, 10, 280, 90, color.Black)
+	FillRect(img, 180, 10, 200, 90, color.Black)
+	FillRect(img, 20, 10, 50, 90, color.Black)
+
+	for _, orientation := range []string{TextOrientationVertical, TextOrientationAuto} {
+		opt := ChangeLineSpaceOption{
+			WidthRatio:     200,
+			HeightRatio:    100,
+			Orientation:    orientation,
+			LineSpaceScale: 0.1,
+			MinSpace:       1,
+			MaxRemove:      9999,
+			Threshold:      180,
+		}
+		result, err := NewChangeLineSpaceFilter(opt).Run(NewFilterSource(img, "filename", 0))
+		if err != nil {
+			t.Fatalf("filter failed : %v", err)
+		}
+		bounds := result.Img().Bounds()
+		if bounds.Dx() != 200 || bounds.Dy() != 100 {
+			t.Errorf("%v : size mismatch. expected=200x100, actual=%vx%v", orientation, bounds.Dx(), bounds.Dy())
+		}
+		if !result.(*ChangeLineSpaceResult).vertical {
+			t.Errorf("%v : page should be processed as vertical text", orientation)
+		}
+		// text columns keep their width and order
+		var widths []int
+		for x := 0; x < bounds.Dx(); x++ {
+			if !isDark(result.Img(), x, 50) {
+				continue
+			}
+			if x == 0 || !isDark(result.Img(), x-1, 50) {
+				widths = append(widths, 0)
+			}
+			widths[len(widths)-1]++
+		}
+		if !reflect.DeepEqual(widths, []int{30, 20, 30}) {
+			t.Errorf("%v : column widths mismatch. actual=%v", orientation, widths)
+		}
+	}
+
+	if _, err := NewChangeLineSpaceOption(map[string]interface{}{"orientation": "diagonal"}); err == nil {
+		t.Errorf("invalid orientation should fail")
+	}
+}
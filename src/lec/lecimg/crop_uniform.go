@@ -0,0 +1,132 @@
+package lecimg
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"sort"
+	"sync"
+)
+
+// uniform crop modes
+const (
+	UniformCropNone    = ""
+	UniformCropBook    = "book"
+	UniformCropOddEven = "oddEven"
+)
+
+func validateUniformCrop(mode string) error {
+	switch mode {
+	case UniformCropNone, UniformCropBook, UniformCropOddEven:
+		return nil
+	}
+	return fmt.Errorf("invalid uniformCrop : %v", mode)
+}
+
+// uniformCropOutlierRate is the max rate of pages whose edge is ignored on each side,
+// so that full-bleed covers and fold-outs do not widen the crop box of the book.
+const uniformCropOutlierRate = 0.1
+
+// uniformCrop collects content rectangles of pages in the analysis pass
+// and provides one crop rectangle per book, or per odd/even pages.
+// Each edge of the crop rectangle contains the edges of most pages,
+// ignoring outlier pages up to uniformCropOutlierRate.
+// It is safe for concurrent use.
+type uniformCrop struct {
+	mode  string
+	mutex sync.Mutex
+	pages [3][]image.Rectangle // even index, odd index, all pages
+	rects [3]image.Rectangle
+	found [3]bool
+	done  bool
+}
+
+func newUniformCrop(mode string) *uniformCrop {
+	if mode == UniformCropNone {
+		return nil
+	}
+	return &uniformCrop{mode: mode}
+}
+
+func (u *uniformCrop) enabled() bool {
+	return u != nil
+}
+
+func (u *uniformCrop) slot(index int) int {
+	if u.mode != UniformCropOddEven || index < 0 {
+		return 2
+	}
+	return index % 2
+}
+
+// consensus returns the rectangle whose edges contain the edges of pages
+// except outliers on each side.
+func consensus(rects []image.Rectangle) image.Rectangle {
+	n := len(rects)
+	outliers := int(float64(n) * uniformCropOutlierRate)
+	edge := func(value func(image.Rectangle) int, outer int) int {
+		values := make([]int, n)
+		for i, rect := range rects {
+			values[i] = value(rect)
+		}
+		sort.Ints(values)
+		if outer < 0 {
+			return values[outliers]
+		}
+		return values[n-1-outliers]
+	}
+	return image.Rect(
+		edge(func(r image.Rectangle) int { return r.Min.X }, -1),
+		edge(func(r image.Rectangle) int { return r.Min.Y }, -1),
+		edge(func(r image.Rectangle) int { return r.Max.X }, 1),
+		edge(func(r image.Rectangle) int { return r.Max.Y }, 1),
+	)
+}
+
+// add adds a content rectangle of a page.
+func (u *uniformCrop) add(index int, rect image.Rectangle) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if slot := u.slot(index); slot != 2 {
+		u.pages[slot] = append(u.pages[slot], rect)
+	}
+	u.pages[2] = append(u.pages[2], rect)
+}
+
+// get returns the crop rectangle for the page.
+// It returns false if no page was analyzed or the analysis pass is not finished.
+func (u *uniformCrop) get(index int) (image.Rectangle, bool) {
+	if u == nil {
+		return image.Rectangle{}, false
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if !u.done {
+		return image.Rectangle{}, false
+	}
+	if slot := u.slot(index); u.found[slot] {
+		return u.rects[slot], true
+	}
+	return u.rects[2], u.found[2]
+}
+
+// end finishes the analysis pass and logs the crop rectangle.
+func (u *uniformCrop) end() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.done = true
+	for slot, rects := range u.pages {
+		if len(rects) > 0 {
+			u.rects[slot], u.found[slot] = consensus(rects), true
+		}
+	}
+	if u.mode == UniformCropOddEven {
+		log.Printf("[CROP] uniform crop : even=%v, odd=%v\n", u.rects[0], u.rects[1])
+	} else {
+		log.Printf("[CROP] uniform crop : %v\n", u.rects[2])
+	}
+}
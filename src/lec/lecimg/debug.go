@@ -0,0 +1,118 @@
+package lecimg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"strings"
+
+	"lec/lecio"
+)
+
+// colors of debug images
+var (
+	debugCropColor    = color.RGBA{255, 0, 0, 255}
+	debugContentColor = color.RGBA{0, 160, 0, 255}
+	debugPaddingColor = color.RGBA{0, 0, 255, 255}
+	debugAngleColor   = color.RGBA{255, 0, 0, 255}
+	debugTextColor    = color.RGBA{255, 0, 255, 255}
+	debugEmptyColor   = color.NRGBA{255, 160, 0, 96}
+	debugLineColor    = color.NRGBA{0, 160, 255, 64}
+	debugFigureColor  = color.NRGBA{0, 160, 0, 64}
+)
+
+// newDebugImage creates an RGBA copy of the image to draw annotations on.
+// Bounds of the returned image starts at (0, 0).
+func newDebugImage(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	dest := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dest, dest.Bounds(), src, bounds.Min, draw.Src)
+	return dest
+}
+
+// newThresholdDebugImage creates a black and white image of dots darker than threshold.
+func newThresholdDebugImage(src image.Image, threshold uint8) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	thresholdSum := uint32(threshold) * 256 * 3
+	img := CreateImage(width, height, color.White)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if r, g, b, _ := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA(); r+g+b < thresholdSum {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	return img
+}
+
+// drawDebugLabels draws lines of text at top left corner.
+func drawDebugLabels(img *image.RGBA, labels []string) {
+	lineHeight := 16
+	for i, label := range labels {
+		y := (i + 1) * lineHeight
+		FillRect(img, 0, y-lineHeight+2, len(label)*8, y+2, color.White)
+		DrawLabelBold8x16(img, 0, y, label, debugTextColor)
+	}
+}
+
+// saveDebugImage writes the debug image as '{filename}.{name}.png' in dir.
+func saveDebugImage(img image.Image, dir, filename, name string) {
+	debugFilename := fmt.Sprintf("%v.%v.png",
+		strings.ToLower(lecio.GetBaseWithoutExt(filename)), name)
+	if err := SavePng(img, dir, debugFilename); err != nil {
+		log.Printf("Error : %v : %v\n", debugFilename, err)
+	}
+}
+
+// drawCropDebug draws rectangles of crop filters.
+// padding is the detection area, content is the detected content area
+// and crop is the final crop area.
+func drawCropDebug(img *image.RGBA, padding, content, crop image.Rectangle) {
+	DrawRect(img, padding, debugPaddingColor)
+	if !content.Empty() {
+		DrawRect(img, content, debugContentColor)
+	}
+	DrawRect(img, crop, debugCropColor)
+	DrawRect(img, crop.Inset(1), debugCropColor)
+	drawDebugLabels(img, []string{
+		fmt.Sprintf("crop: %v", crop),
+		fmt.Sprintf("content: %v", content),
+		fmt.Sprintf("margin: top=%v, bottom=%v, left=%v, right=%v",
+			content.Min.Y-crop.Min.Y,
+			crop.Max.Y-content.Max.Y,
+			content.Min.X-crop.Min.X,
+			crop.Max.X-content.Max.X),
+	})
+}
+
+// angleScore is the non-empty line count of a rotation angle candidate.
+type angleScore struct {
+	angle float32
+	count int
+}
+
+// drawDeskewDebug draws scan lines of the detected angle and candidate scores.
+func drawDeskewDebug(img *image.RGBA, angle float32, scores []angleScore) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// scan lines are sloped by sin(angle) as calcNonEmptyLineCount does.
+	dy, _ := Sincosf32(angle)
+	for y := 0; y < height; y += 40 {
+		DrawLine(img, 0, y, width, y+int(dy*float32(width)), debugAngleColor)
+	}
+
+	labels := []string{fmt.Sprintf("angle: %.2f", angle)}
+	for _, score := range scores {
+		mark := ""
+		if score.angle == angle {
+			mark = " *"
+		}
+		labels = append(labels, fmt.Sprintf("%6.2f : %v%v", score.angle, score.count, mark))
+	}
+	drawDebugLabels(img, labels)
+}
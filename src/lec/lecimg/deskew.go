@@ -17,24 +17,41 @@ type DeskewOption struct {
 	IncrStep             float32 // rotation angle increment step (0 <= value <= 360)
 	EmptyLineMaxDotCount int
 	EmptyLineMaxDotRate  float32 // max dot count rate (0 <= value < 1.0)
-	DebugOutputDir       string
+	DebugOutputDir       string  // writes annotated images if not empty
 	DebugMode            bool
-	Threshold            uint8   // min brightness of space (0~255)
-	DetectToleranceRate  float32 // max dot count diff rate (0 <= value < 1.0)
+	Threshold            uint8            // min brightness of space (0~255)
+	AutoThreshold        bool             // selects Threshold of each page by Otsu's method ("threshold: auto")
+	LockThreshold        bool             // uses one auto threshold for the book
+	DetectToleranceRate  float32          // max dot count diff rate (0 <= value < 1.0)
+	Despeckle            *DespeckleOption // ignores specks in angle detection without changing output
+	Flatten              *FlattenOption   // flattens lighting for angle detection without changing output
 }
 
 func NewDeskewOption(m map[string]interface{}) (*DeskewOption, error) {
 	option := DeskewOption{}
 
+	m, auto := parseAutoThreshold(m)
 	err := mapstructure.Decode(m, &option)
 	if err != nil {
 		return nil, err
 	}
+	option.AutoThreshold = option.AutoThreshold || auto
+	if option.Despeckle != nil {
+		if err := option.Despeckle.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if option.Flatten != nil {
+		if err := option.Flatten.validate(); err != nil {
+			return nil, err
+		}
+	}
 
 	return &option, nil
 }
 
 type DeskewResult struct {
+	thresholdResult
 	image        image.Image
 	filename     string
 	rotatedAngle float32
@@ -45,48 +62,103 @@ func (r DeskewResult) Img() image.Image {
 }
 
 func (r DeskewResult) Log() {
+	r.logThreshold()
 	if r.rotatedAngle != 0 {
 		log.Printf("[ROTATE] %v : %.1f", r.filename, r.rotatedAngle)
 	}
 }
 
+func (r DeskewResult) Report(report *PageReport) {
+	angle := r.rotatedAngle
+	report.SkewAngle = &angle
+	r.reportThreshold(report)
+}
+
 // ----------------------------------------------------------------------------
 // ----------------------------------------------------------------------------
 
 type DeskewFilter struct {
+	autoThresholdFilter
 	option DeskewOption
 }
 
 // Create DeskewFilter instance
 func NewDeskewFilter(option DeskewOption) *DeskewFilter {
-	return &DeskewFilter{option}
+	return &DeskewFilter{
+		option:              option,
+		autoThresholdFilter: autoThresholdFilter{newAutoThreshold(option.AutoThreshold, option.LockThreshold)},
+	}
+}
+
+func init() {
+	RegisterFilter("deskew", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewDeskewOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewDeskewFilter(*option), nil
+	})
 }
 
 // Implements Filter.Run()
-func (f DeskewFilter) Run(s *FilterSource) FilterResult {
-	resultImage, rotatedAngle := f.run(s.image, s.filename)
-	return DeskewResult{resultImage, s.filename, rotatedAngle}
+func (f DeskewFilter) Run(s *FilterSource) (FilterResult, error) {
+	f.option.DebugOutputDir = s.debugOutputDir(f.option.DebugOutputDir)
+	detect := flattenedImage(s.image, f.option.Flatten)
+	if f.threshold.enabled() {
+		f.option.Threshold = f.threshold.get(detect)
+	}
+	resultImage, rotatedAngle := f.run(s.image, detect, s.filename)
+	return DeskewResult{
+		thresholdResult{s.filename, f.threshold.enabled(), f.option.Threshold},
+		resultImage, s.filename, rotatedAngle,
+	}, nil
 }
 
-// actual deskew implementation
-func (f DeskewFilter) run(src image.Image, name string) (image.Image, float32) {
-	bounds := src.Bounds()
-	var rgba *image.RGBA
-
-	switch src.(type) {
-	case *image.RGBA:
-		rgba = src.(*image.RGBA)
-	default:
-		rgba = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
-		draw.Draw(rgba, bounds, src, bounds.Min, draw.Src)
+// Implements BookFilter.Analyze()
+func (f DeskewFilter) Analyze(s *FilterSource) error {
+	f.threshold.add(flattenedImage(s.image, f.option.Flatten))
+	return nil
+}
+
+// actual deskew implementation. the angle is detected in detect and src is rotated.
+func (f DeskewFilter) run(src, detect image.Image, name string) (image.Image, float32) {
+	rgba := rgbaImage(src)
+	detectRGBA := rgba
+	if detect != src {
+		detectRGBA = rgbaImage(detect)
 	}
 
-	if angle := f.detectAngle(rgba, name); angle != 0 {
+	// despeckled copy of RGBA image is also RGBA
+	detectRGBA = detectionImage(detectRGBA, f.option.Despeckle, f.option.Threshold).(*image.RGBA)
+	angle, scores := f.detectAngle(detectRGBA, name)
+	if f.option.DebugOutputDir != "" {
+		f.saveDebugImage(detectRGBA, name, angle, scores)
+	}
+	if angle != 0 {
 		return f.rotateImage(rgba, angle), angle
 	}
 	return src, 0
 }
 
+// rgbaImage returns the image as *image.RGBA. Other types are copied
+// into an image whose bounds starts at (0, 0).
+func rgbaImage(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok {
+		return rgba
+	}
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	return rgba
+}
+
+// saveDebugImage writes the thresholded image with scan lines of detected angle.
+func (f DeskewFilter) saveDebugImage(src *image.RGBA, name string, angle float32, scores []angleScore) {
+	img := newThresholdDebugImage(src, f.option.Threshold)
+	drawDeskewDebug(img, angle, scores)
+	saveDebugImage(img, f.option.DebugOutputDir, name, "deskew")
+}
+
 // Rotate image
 func (f DeskewFilter) rotateImage(src image.Image, angle float32) image.Image {
 	bounds := src.Bounds()
@@ -98,8 +170,9 @@ func (f DeskewFilter) rotateImage(src image.Image, angle float32) image.Image {
 	return dest
 }
 
-func (f DeskewFilter) detectAngle(src *image.RGBA, name string) float32 {
+func (f DeskewFilter) detectAngle(src *image.RGBA, name string) (float32, []angleScore) {
 	minNonEmptyLineCount := f.calcNonEmptyLineCount(src, 0, name)
+	scores := []angleScore{{0, minNonEmptyLineCount}}
 	tolerance := int(float32(src.Bounds().Dx()) * f.option.DetectToleranceRate)
 
 	// increase rotation angle by incrStep
@@ -113,6 +186,7 @@ func (f DeskewFilter) detectAngle(src *image.RGBA, name string) float32 {
 		for angle := incrStep; angle <= f.option.MaxRotation; angle += incrStep {
 			if positiveDir {
 				nonEmptyLineCount := f.calcNonEmptyLineCount(src, angle, name)
+				scores = append(scores, angleScore{angle, nonEmptyLineCount})
 
 				if nonEmptyLineCount < minNonEmptyLineCount {
 					minNonEmptyLineCount = nonEmptyLineCount
@@ -124,6 +198,7 @@ func (f DeskewFilter) detectAngle(src *image.RGBA, name string) float32 {
 
 			if angle > 0 && negativeDir {
 				nonEmptyLineCount := f.calcNonEmptyLineCount(src, -angle, name)
+				scores = append(scores, angleScore{-angle, nonEmptyLineCount})
 
 				if nonEmptyLineCount < minNonEmptyLineCount {
 					minNonEmptyLineCount = nonEmptyLineCount
@@ -135,7 +210,7 @@ func (f DeskewFilter) detectAngle(src *image.RGBA, name string) float32 {
 		}
 	}
 
-	return detectedAngle
+	return detectedAngle, scores
 }
 
 func (f DeskewFilter) calcNonEmptyLineCount(src *image.RGBA, angle float32, name string) int {
@@ -17,6 +17,7 @@ type DeskewEDOption struct {
 	IncrStep             float32 // rotation angle increment step (0 <= value <= 360)
 	EmptyLineMaxDotCount int
 	EmptyLineMaxDotRate  float32 // max dot count rate (0 <= value < 1.0)
+	DebugOutputDir       string  // writes annotated images if not empty
 	DebugMode            bool
 	Threshold            uint8   // edge strength threshold (0~255(max edge))
 	DetectToleranceRate  float32 // max dot count diff rate (0 <= value < 1.0)
@@ -49,6 +50,11 @@ func (r DeskewEDResult) Log() {
 	}
 }
 
+func (r DeskewEDResult) Report(report *PageReport) {
+	angle := r.rotatedAngle
+	report.SkewAngle = &angle
+}
+
 // ----------------------------------------------------------------------------
 // EdgeDetectedDeskewFilter
 // ----------------------------------------------------------------------------
@@ -76,10 +82,21 @@ func NewDeskewEDFilter(option DeskewEDOption) *DeskewEDFilter {
 	}
 }
 
+func init() {
+	RegisterFilter("deskewED", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewDeskewEDOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewDeskewEDFilter(*option), nil
+	})
+}
+
 // Implements Filter.Run()
-func (f DeskewEDFilter) Run(s *FilterSource) FilterResult {
+func (f DeskewEDFilter) Run(s *FilterSource) (FilterResult, error) {
+	f.option.DebugOutputDir = s.debugOutputDir(f.option.DebugOutputDir)
 	resultImage, rotatedAngle := f.run(s.image, s.filename)
-	return DeskewEDResult{resultImage, s.filename, rotatedAngle}
+	return DeskewEDResult{resultImage, s.filename, rotatedAngle}, nil
 }
 
 // actual deskew implementation
@@ -89,7 +106,13 @@ func (f DeskewEDFilter) run(src image.Image, name string) (image.Image, float32)
 	f.edgeDetect.Draw(edImg, src)
 
 	// Find preferred rotation angle
-	if angle := f.detectAngle(edImg, name); angle != 0 {
+	angle, scores := f.detectAngle(edImg, name)
+	if f.option.DebugOutputDir != "" {
+		img := newDebugImage(edImg)
+		drawDeskewDebug(img, angle, scores)
+		saveDebugImage(img, f.option.DebugOutputDir, name, "deskewED")
+	}
+	if angle != 0 {
 		return f.rotateImage(src, angle), angle
 	}
 	return src, 0
@@ -107,8 +130,9 @@ func (f DeskewEDFilter) rotateImage(src image.Image, angle float32) image.Image
 }
 
 // Detect rotation angle
-func (f DeskewEDFilter) detectAngle(edImg *image.Gray, name string) float32 {
+func (f DeskewEDFilter) detectAngle(edImg *image.Gray, name string) (float32, []angleScore) {
 	minNonEmptyLineCount := f.calcNonEmptyLineCount(edImg, 0, name)
+	scores := []angleScore{{0, minNonEmptyLineCount}}
 	tolerance := int(float32(edImg.Bounds().Dx()) * f.option.DetectToleranceRate)
 
 	// increase rotation angle by incrStep
@@ -122,6 +146,7 @@ func (f DeskewEDFilter) detectAngle(edImg *image.Gray, name string) float32 {
 		for angle := incrStep; angle <= f.option.MaxRotation; angle += incrStep {
 			if positiveDir {
 				nonEmptyLineCount := f.calcNonEmptyLineCount(edImg, angle, name)
+				scores = append(scores, angleScore{angle, nonEmptyLineCount})
 
 				if nonEmptyLineCount < minNonEmptyLineCount {
 					minNonEmptyLineCount = nonEmptyLineCount
@@ -133,6 +158,7 @@ func (f DeskewEDFilter) detectAngle(edImg *image.Gray, name string) float32 {
 
 			if angle > 0 && negativeDir {
 				nonEmptyLineCount := f.calcNonEmptyLineCount(edImg, -angle, name)
+				scores = append(scores, angleScore{-angle, nonEmptyLineCount})
 
 				if nonEmptyLineCount < minNonEmptyLineCount {
 					minNonEmptyLineCount = nonEmptyLineCount
@@ -144,7 +170,7 @@ func (f DeskewEDFilter) detectAngle(edImg *image.Gray, name string) float32 {
 		}
 	}
 
-	return detectedAngle
+	return detectedAngle, scores
 }
 
 func (f DeskewEDFilter) calcNonEmptyLineCount(edImg *image.Gray, angle float32, name string) int {
@@ -8,7 +8,10 @@ import (
 
 func testDeskewED(t *testing.T, img image.Image, option DeskewEDOption, rotatedAngleMin, rotatedAngleMax float32) {
 	// Run Filter
-	result := NewDeskewEDFilter(option).Run(NewFilterSource(img, "filename", 0))
+	result, err := NewDeskewEDFilter(option).Run(NewFilterSource(img, "filename", 0))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
 	rotatedAngle := result.(DeskewEDResult).rotatedAngle
 
 	// Test result image size
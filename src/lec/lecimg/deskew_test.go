@@ -11,7 +11,10 @@ func testDeskew(t *testing.T,
 	option DeskewOption,
 	rotatedAngleMin, rotatedAngleMax float32) {
 	// Run Filter
-	result := NewDeskewFilter(option).Run(NewFilterSource(img, "filename", 0))
+	result, err := NewDeskewFilter(option).Run(NewFilterSource(img, "filename", 0))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
 	rotatedAngle := result.(DeskewResult).rotatedAngle
 
 	// Test result image size
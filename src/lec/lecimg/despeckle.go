@@ -0,0 +1,228 @@
+package lecimg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// default values of DespeckleOption
+const (
+	defaultDespeckleMaxArea    = 4
+	defaultDespeckleMarginRate = 0.1
+)
+
+type DespeckleOption struct {
+	Threshold   uint8   // min brightness of space (0~255). detection filters use their own threshold if 0
+	MaxArea     int     // components with no more dots are removed (default: 4 if MaxSize is 0)
+	MaxSize     int     // components whose width and height are not larger are removed
+	MarginsOnly bool    // removes components only inside the margins
+	MarginRate  float32 // width of margins as rate of page width and height (default: 0.1)
+}
+
+func NewDespeckleOption(m map[string]interface{}) (*DespeckleOption, error) {
+	option := DespeckleOption{}
+
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+	if err := option.validate(); err != nil {
+		return nil, err
+	}
+
+	return &option, nil
+}
+
+func (o DespeckleOption) validate() error {
+	if o.MaxArea < 0 || o.MaxSize < 0 {
+		return fmt.Errorf("invalid despeckle size : maxArea=%v, maxSize=%v", o.MaxArea, o.MaxSize)
+	}
+	if o.MarginRate < 0 || o.MarginRate >= 0.5 {
+		return fmt.Errorf("invalid marginRate : %v", o.MarginRate)
+	}
+	return nil
+}
+
+// withDefaults fills default values and the threshold of the detection filter.
+func (o DespeckleOption) withDefaults(threshold uint8) DespeckleOption {
+	if o.Threshold == 0 {
+		o.Threshold = threshold
+	}
+	if o.MaxArea == 0 && o.MaxSize == 0 {
+		o.MaxArea = defaultDespeckleMaxArea
+	}
+	if o.MarginRate == 0 {
+		o.MarginRate = defaultDespeckleMarginRate
+	}
+	return o
+}
+
+type DespeckleResult struct {
+	image    image.Image
+	filename string
+	removed  int
+}
+
+func (r DespeckleResult) Img() image.Image {
+	return r.image
+}
+
+func (r DespeckleResult) Log() {
+	if r.removed > 0 {
+		log.Printf("[DESPECKLE] %v : %v\n", r.filename, r.removed)
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// DespeckleFilter removes small connected components of dark dots
+// such as scanner dust and JPEG noise.
+type DespeckleFilter struct {
+	option DespeckleOption
+}
+
+func NewDespeckleFilter(option DespeckleOption) *DespeckleFilter {
+	return &DespeckleFilter{option: option.withDefaults(option.Threshold)}
+}
+
+func init() {
+	RegisterFilter("despeckle", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewDespeckleOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewDespeckleFilter(*option), nil
+	})
+}
+
+// Implements Filter.Run()
+func (f DespeckleFilter) Run(s *FilterSource) (FilterResult, error) {
+	dest, removed := despeckle(s.image, f.option, true)
+	return DespeckleResult{dest, s.filename, removed}, nil
+}
+
+// detectionImage returns the image for edge and angle detection of filters.
+// Specks are removed if option is not nil. threshold is used if the option has no threshold.
+func detectionImage(src image.Image, option *DespeckleOption, threshold uint8) image.Image {
+	if option == nil {
+		return src
+	}
+	dest, _ := despeckle(src, option.withDefaults(threshold), false)
+	return dest
+}
+
+// speck is a connected component of dark dots.
+type speck struct {
+	rect image.Rectangle
+	dots []int // offsets of dots (y * width + x)
+}
+
+// findSpecks labels 8-connected components of dots darker than the threshold
+// and returns the components to remove.
+func findSpecks(src image.Image, o DespeckleOption) []speck {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	thresholdSum := uint32(o.Threshold) * 256 * 3
+	dark := make([]bool, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if r, g, b, _ := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA(); r+g+b < thresholdSum {
+				dark[y*width+x] = true
+			}
+		}
+	}
+
+	marginX, marginY := int(float32(width)*o.MarginRate), int(float32(height)*o.MarginRate)
+	content := image.Rect(marginX, marginY, width-marginX, height-marginY)
+
+	var specks []speck
+	visited := make([]bool, width*height)
+	var stack []int
+	for start, isDark := range dark {
+		if !isDark || visited[start] {
+			continue
+		}
+
+		// flood fill the component
+		var dots []int
+		rect := image.Rect(start%width, start/width, start%width+1, start/width+1)
+		visited[start] = true
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			dots = append(dots, i)
+
+			x, y := i%width, i/width
+			rect = rect.Union(image.Rect(x, y, x+1, y+1))
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || ny < 0 || nx >= width || ny >= height {
+						continue
+					}
+					if n := ny*width + nx; dark[n] && !visited[n] {
+						visited[n] = true
+						stack = append(stack, n)
+					}
+				}
+			}
+		}
+
+		small := (o.MaxArea > 0 && len(dots) <= o.MaxArea) ||
+			(o.MaxSize > 0 && rect.Dx() <= o.MaxSize && rect.Dy() <= o.MaxSize)
+		if small && (!o.MarginsOnly || !rect.Overlaps(content)) {
+			specks = append(specks, speck{rect, dots})
+		}
+	}
+	return specks
+}
+
+// despeckle returns a copy of the image without specks and the number of removed specks.
+// Specks are painted with the surrounding background if keepBackground is true,
+// otherwise with white for detection.
+// If any speck is removed, the returned image's bounds starts at (0, 0).
+func despeckle(src image.Image, o DespeckleOption, keepBackground bool) (image.Image, int) {
+	specks := findSpecks(src, o)
+	if len(specks) == 0 {
+		return src, 0
+	}
+
+	dest := cropImage(src, src.Bounds()).(draw.Image)
+	width := dest.Bounds().Dx()
+	thresholdSum := uint32(o.Threshold) * 256 * 3
+	for _, s := range specks {
+		var c color.Color = color.White
+		if keepBackground {
+			c = backgroundAround(dest, s.rect, thresholdSum)
+		}
+		for _, i := range s.dots {
+			dest.Set(i%width, i/width, c)
+		}
+	}
+	return dest, len(specks)
+}
+
+// backgroundAround returns the average color of light dots around the rectangle.
+func backgroundAround(img image.Image, rect image.Rectangle, thresholdSum uint32) color.Color {
+	area := rect.Inset(-1).Intersect(img.Bounds())
+	var sumR, sumG, sumB, count uint32
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			if r, g, b, _ := img.At(x, y).RGBA(); r+g+b >= thresholdSum {
+				sumR, sumG, sumB = sumR+r>>8, sumG+g>>8, sumB+b>>8
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return color.White
+	}
+	return color.RGBA{uint8(sumR / count), uint8(sumG / count), uint8(sumB / count), 255}
+}
@@ -0,0 +1,74 @@
+package lecimg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// newDustyPage creates a page with a text block, dust in the margin and dust in the text area.
+func newDustyPage() *image.RGBA {
+	img := CreateImage(200, 300, color.White)
+	FillRect(img, 50, 50, 150, 250, color.Black)
+	FillRect(img, 5, 5, 7, 7, color.Black)         // dust in the margin
+	FillRect(img, 100, 270, 101, 271, color.Black) // dust near the bottom edge
+	FillRect(img, 160, 150, 161, 151, color.Black) // dust in the content area
+	return img
+}
+
+func TestDespeckle(t *testing.T) {
+	result := runTestFilter(t, NewDespeckleFilter(DespeckleOption{Threshold: 128}), newDustyPage())
+	img := result.Img()
+	if isDark(img, 5, 5) || isDark(img, 100, 270) || isDark(img, 160, 150) {
+		t.Errorf("specks should be removed")
+	}
+	if !isDark(img, 100, 100) {
+		t.Errorf("text should be kept")
+	}
+	if removed := result.(DespeckleResult).removed; removed != 3 {
+		t.Errorf("removed count mismatch. expected=3, actual=%v", removed)
+	}
+}
+
+func TestDespeckleMarginsOnly(t *testing.T) {
+	option := DespeckleOption{Threshold: 128, MarginsOnly: true, MarginRate: 0.15}
+	img := runTestFilter(t, NewDespeckleFilter(option), newDustyPage()).Img()
+	if isDark(img, 5, 5) || isDark(img, 100, 270) {
+		t.Errorf("specks in the margins should be removed")
+	}
+	if !isDark(img, 160, 150) {
+		t.Errorf("speck in the content area should be kept")
+	}
+}
+
+func TestAutoCropDespeckle(t *testing.T) {
+	option := AutoCropOption{
+		Threshold: 128,
+		MinRatio:  1.0, MaxRatio: 3.0,
+		MaxWidthCropRate: 0.5, MaxHeightCropRate: 0.5,
+		Despeckle: &DespeckleOption{},
+	}
+	img := newDustyPage()
+	FillRect(img, 90, 140, 110, 160, color.White)
+	FillRect(img, 100, 150, 101, 151, color.Black) // dust in a hole of the text
+
+	result := runTestFilter(t, NewAutoCropFilter(option), img)
+	if rect := result.(AutoCropResult).rect; rect != image.Rect(50, 50, 150, 250) {
+		t.Errorf("crop rect mismatch. actual=%v", rect)
+	}
+	if !isDark(result.Img(), 100, 150) {
+		t.Errorf("output pixels should not be changed")
+	}
+}
+
+func TestDespeckleOption(t *testing.T) {
+	filter, err := NewFilter("deskew", map[string]interface{}{
+		"despeckle": map[string]interface{}{"maxSize": 3},
+	})
+	if err != nil {
+		t.Fatalf("failed to create filter : %v", err)
+	}
+	if despeckle := filter.(*DeskewFilter).option.Despeckle; despeckle == nil || despeckle.MaxSize != 3 {
+		t.Errorf("despeckle option mismatch. actual=%v", despeckle)
+	}
+}
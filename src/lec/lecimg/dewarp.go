@@ -0,0 +1,461 @@
+package lecimg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// displacement models of DewarpFilter
+const (
+	DewarpModelCylinder   = "cylinder"
+	DewarpModelPolynomial = "polynomial"
+)
+
+// default values of DewarpOption
+const (
+	defaultDewarpDegree              = 3
+	defaultDewarpSlices              = 20
+	defaultDewarpMinLines            = 3
+	defaultDewarpMinDisplacement     = 1
+	defaultDewarpMaxDisplacementRate = 0.1
+)
+
+type DewarpOption struct {
+	Threshold           uint8   // min brightness of space (0~255)
+	AutoThreshold       bool    // selects Threshold of each page by Otsu's method ("threshold: auto")
+	LockThreshold       bool    // uses one auto threshold for the book
+	Model               string  // "cylinder"(default) : displacement linear in y, "polynomial" : interpolates between lines
+	Degree              int     // degree of the polynomial of each line (1~5, default: 3)
+	Slices              int     // number of vertical slices to detect lines (default: 20)
+	MinLines            int     // min number of detected lines to dewarp (default: 3)
+	MinDisplacement     float32 // pages with smaller max displacement are left alone (default: 1)
+	MaxDisplacementRate float32 // pages with larger max displacement as rate of height are left alone (default: 0.1)
+	DebugOutputDir      string  // writes annotated images if not empty
+}
+
+func NewDewarpOption(m map[string]interface{}) (*DewarpOption, error) {
+	option := DewarpOption{}
+
+	m, auto := parseAutoThreshold(m)
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+	option.AutoThreshold = option.AutoThreshold || auto
+
+	switch option.Model {
+	case "", DewarpModelCylinder, DewarpModelPolynomial:
+	default:
+		return nil, fmt.Errorf("invalid model : %v", option.Model)
+	}
+	if option.Degree < 0 || option.Degree > 5 {
+		return nil, fmt.Errorf("invalid degree : %v", option.Degree)
+	}
+	if option.Slices < 0 || option.Slices == 1 || option.MinLines < 0 {
+		return nil, fmt.Errorf("invalid slices or minLines : slices=%v, minLines=%v",
+			option.Slices, option.MinLines)
+	}
+
+	return &option, nil
+}
+
+type DewarpResult struct {
+	thresholdResult
+	image           image.Image
+	lines           int
+	maxDisplacement float32
+	dewarped        bool
+}
+
+func (r DewarpResult) Img() image.Image {
+	return r.image
+}
+
+func (r DewarpResult) Log() {
+	r.logThreshold()
+	if r.dewarped {
+		log.Printf("[DEWARP] %v : lines=%v, max=%.1f\n", r.filename, r.lines, r.maxDisplacement)
+	}
+}
+
+func (r DewarpResult) Report(report *PageReport) {
+	r.reportThreshold(report)
+}
+
+// ----------------------------------------------------------------------------
+
+// DewarpFilter straightens text lines curved near the spine of bound books.
+// It fits a polynomial to each text line and remaps every column vertically
+// with a displacement model built from the lines.
+// It uses no randomness, so the result is the same on every run.
+type DewarpFilter struct {
+	autoThresholdFilter
+	option DewarpOption
+}
+
+func NewDewarpFilter(option DewarpOption) *DewarpFilter {
+	if option.Model == "" {
+		option.Model = DewarpModelCylinder
+	}
+	if option.Degree == 0 {
+		option.Degree = defaultDewarpDegree
+	}
+	if option.Slices == 0 {
+		option.Slices = defaultDewarpSlices
+	}
+	if option.MinLines == 0 {
+		option.MinLines = defaultDewarpMinLines
+	}
+	if option.MinDisplacement == 0 {
+		option.MinDisplacement = defaultDewarpMinDisplacement
+	}
+	if option.MaxDisplacementRate == 0 {
+		option.MaxDisplacementRate = defaultDewarpMaxDisplacementRate
+	}
+
+	return &DewarpFilter{
+		option:              option,
+		autoThresholdFilter: autoThresholdFilter{newAutoThreshold(option.AutoThreshold, option.LockThreshold)},
+	}
+}
+
+func init() {
+	RegisterFilter("dewarp", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewDewarpOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewDewarpFilter(*option), nil
+	})
+}
+
+// Implements Filter.Run()
+func (f DewarpFilter) Run(s *FilterSource) (FilterResult, error) {
+	f.option.DebugOutputDir = s.debugOutputDir(f.option.DebugOutputDir)
+	if f.threshold.enabled() {
+		f.option.Threshold = f.threshold.get(s.image)
+	}
+	threshold := thresholdResult{s.filename, f.threshold.enabled(), f.option.Threshold}
+
+	src := s.image
+	height := src.Bounds().Dy()
+	lines := f.fitLines(src)
+	displacements, maxDisplacement := f.displacements(lines, src.Bounds().Dx(), height)
+	if f.option.DebugOutputDir != "" {
+		f.saveDebugImage(src, s.filename, lines, maxDisplacement)
+	}
+
+	if len(lines) < f.option.MinLines ||
+		maxDisplacement < f.option.MinDisplacement ||
+		maxDisplacement > float32(height)*f.option.MaxDisplacementRate {
+		return DewarpResult{threshold, src, len(lines), maxDisplacement, false}, nil
+	}
+	return DewarpResult{threshold, remapColumns(src, displacements), len(lines), maxDisplacement, true}, nil
+}
+
+// curvedLine is a text line fitted by a polynomial y = f(x).
+type curvedLine struct {
+	coefficients []float64 // of x normalized to -1~1
+	target       float64   // y of the straightened line
+}
+
+func (l curvedLine) y(x, width int) float64 {
+	return evalPolynomial(l.coefficients, normalizeX(x, width))
+}
+
+// normalizeX maps 0~width-1 to -1~1 to keep the least squares well conditioned.
+func normalizeX(x, width int) float64 {
+	if width < 2 {
+		return 0
+	}
+	return 2*float64(x)/float64(width-1) - 1
+}
+
+// lineSample is the centre of a text line in a slice.
+type lineSample struct {
+	x, y   float64
+	height int
+	used   bool
+}
+
+// fitLines detects text lines in vertical slices, tracks them across slices
+// and fits a polynomial to each line. Lines sorted by target y are returned.
+func (f DewarpFilter) fitLines(src image.Image) []curvedLine {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	slices := Min(f.option.Slices, width)
+	if slices < 2 {
+		return nil
+	}
+
+	thresholdSum := uint32(f.option.Threshold) * 256 * 3
+	samples := make([][]*lineSample, slices)
+	var heights []int
+	for i := range samples {
+		xStart, xEnd := width*i/slices, width*(i+1)/slices
+		start := -1
+		var sum, weight float64
+		for y := 0; y <= height; y++ {
+			count := 0
+			if y < height {
+				count = countLineDots(src, bounds.Min.Y+y, bounds.Min.X+xStart, bounds.Min.X+xEnd, thresholdSum, -1)
+			}
+			if count > 0 {
+				if start < 0 {
+					start, sum, weight = y, 0, 0
+				}
+				sum += float64(y * count)
+				weight += float64(count)
+			} else if start >= 0 {
+				samples[i] = append(samples[i], &lineSample{
+					x:      float64(xStart+xEnd-1) / 2,
+					y:      sum / weight,
+					height: y - start,
+				})
+				heights = append(heights, y-start)
+				start = -1
+			}
+		}
+	}
+	if len(heights) == 0 {
+		return nil
+	}
+
+	// lines have similar heights. taller runs are figures or merged lines.
+	sort.Ints(heights)
+	lineHeight := heights[len(heights)/2]
+	for i := range samples {
+		for _, sample := range samples[i] {
+			sample.used = sample.height > lineHeight*2
+		}
+	}
+
+	// tracks lines from the slice with most samples
+	reference := 0
+	for i := range samples {
+		if len(samples[i]) > len(samples[reference]) {
+			reference = i
+		}
+	}
+
+	var lines []curvedLine
+	minSamples := Max(f.option.Degree+1, slices/2)
+	for _, start := range samples[reference] {
+		if start.used {
+			continue
+		}
+		start.used = true
+		track := []*lineSample{start}
+		for _, step := range []int{-1, 1} {
+			last := start
+			for i := reference + step; i >= 0 && i < slices; i += step {
+				next := nearestSample(samples[i], last.y, float64(lineHeight)/2)
+				if next == nil {
+					continue
+				}
+				next.used = true
+				track = append(track, next)
+				last = next
+			}
+		}
+		if len(track) < minSamples {
+			continue
+		}
+
+		xs, ys := make([]float64, len(track)), make([]float64, len(track))
+		for i, sample := range track {
+			xs[i] = 2*sample.x/float64(width-1) - 1
+			ys[i] = sample.y
+		}
+		coefficients, ok := fitPolynomial(xs, ys, f.option.Degree)
+		if !ok {
+			continue
+		}
+		line := curvedLine{coefficients: coefficients}
+		for x := 0; x < width; x++ {
+			line.target += line.y(x, width)
+		}
+		line.target /= float64(width)
+		lines = append(lines, line)
+	}
+
+	sort.Slice(lines, func(i, j int) bool { return lines[i].target < lines[j].target })
+	return lines
+}
+
+// nearestSample returns the unused sample nearest to y within tolerance.
+func nearestSample(samples []*lineSample, y, tolerance float64) *lineSample {
+	var nearest *lineSample
+	for _, sample := range samples {
+		if d := math.Abs(sample.y - y); !sample.used && d <= tolerance {
+			if nearest == nil || d < math.Abs(nearest.y-y) {
+				nearest = sample
+			}
+		}
+	}
+	return nearest
+}
+
+// displacements returns the source y offset of every dot of the output
+// (displacements[x][y]) and the max displacement.
+func (f DewarpFilter) displacements(lines []curvedLine, width, height int) ([][]float32, float32) {
+	if len(lines) == 0 {
+		return nil, 0
+	}
+
+	targets := make([]float64, len(lines))
+	for i, line := range lines {
+		targets[i] = line.target
+	}
+
+	displacements := make([][]float32, width)
+	maxDisplacement := float32(0)
+	offsets := make([]float64, len(lines))
+	for x := 0; x < width; x++ {
+		for i, line := range lines {
+			offsets[i] = line.y(x, width) - line.target
+		}
+
+		column := make([]float32, height)
+		if f.option.Model == DewarpModelCylinder {
+			// offset = a + b * y by least squares over lines
+			degree := Min(1, len(lines)-1)
+			coefficients, _ := fitPolynomial(targets, offsets, degree)
+			for y := range column {
+				column[y] = float32(evalPolynomial(coefficients, float64(y)))
+			}
+		} else {
+			// linear interpolation between adjacent lines
+			i := 0
+			for y := range column {
+				for i < len(lines) && lines[i].target < float64(y) {
+					i++
+				}
+				switch {
+				case i == 0:
+					column[y] = float32(offsets[0])
+				case i == len(lines):
+					column[y] = float32(offsets[len(lines)-1])
+				default:
+					t := (float64(y) - lines[i-1].target) / (lines[i].target - lines[i-1].target)
+					column[y] = float32(offsets[i-1]*(1-t) + offsets[i]*t)
+				}
+			}
+		}
+
+		for _, d := range column {
+			maxDisplacement = Maxf32(maxDisplacement, Absf32(d))
+		}
+		displacements[x] = column
+	}
+	return displacements, maxDisplacement
+}
+
+// remapColumns moves each dot of the output by its displacement from the source
+// with linear interpolation between rows. Rows out of the page repeat the edge.
+func remapColumns(src image.Image, displacements [][]float32) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	gray, isGray := src.(*image.Gray)
+	var destGray *image.Gray
+	var destRGBA *image.RGBA
+	if isGray {
+		destGray = image.NewGray(image.Rect(0, 0, width, height))
+	} else {
+		destRGBA = image.NewRGBA(image.Rect(0, 0, width, height))
+	}
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			sy := Maxf32(0, Minf32(float32(height-1), float32(y)+displacements[x][y]))
+			y0 := int(sy)
+			y1 := Min(y0+1, height-1)
+			t := sy - float32(y0)
+
+			if isGray {
+				v0 := float32(gray.GrayAt(bounds.Min.X+x, bounds.Min.Y+y0).Y)
+				v1 := float32(gray.GrayAt(bounds.Min.X+x, bounds.Min.Y+y1).Y)
+				destGray.SetGray(x, y, color.Gray{uint8(v0*(1-t) + v1*t + 0.5)})
+				continue
+			}
+			r0, g0, b0, a0 := src.At(bounds.Min.X+x, bounds.Min.Y+y0).RGBA()
+			r1, g1, b1, a1 := src.At(bounds.Min.X+x, bounds.Min.Y+y1).RGBA()
+			mix := func(v0, v1 uint32) uint8 {
+				return uint8((float32(v0>>8)*(1-t) + float32(v1>>8)*t) + 0.5)
+			}
+			destRGBA.SetRGBA(x, y, color.RGBA{mix(r0, r1), mix(g0, g1), mix(b0, b1), mix(a0, a1)})
+		}
+	}
+
+	if isGray {
+		return destGray
+	}
+	return destRGBA
+}
+
+// saveDebugImage writes the page with fitted lines.
+func (f DewarpFilter) saveDebugImage(src image.Image, filename string, lines []curvedLine, maxDisplacement float32) {
+	img := newDebugImage(src)
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	for _, line := range lines {
+		for x := 0; x < width; x++ {
+			if y := int(line.y(x, width)); y >= 0 && y < height {
+				img.Set(x, y, debugAngleColor)
+			}
+			if y := int(line.target); y >= 0 && y < height && x%4 == 0 {
+				img.Set(x, y, debugContentColor)
+			}
+		}
+	}
+	drawDebugLabels(img, []string{
+		fmt.Sprintf("lines : %v", len(lines)),
+		fmt.Sprintf("max   : %.1f", maxDisplacement),
+	})
+	saveDebugImage(img, f.option.DebugOutputDir, filename, "dewarp")
+}
+
+// fitPolynomial returns coefficients c[0] + c[1]x + c[2]x^2 ... fitted by least squares.
+// It returns false if the points cannot determine the polynomial.
+func fitPolynomial(xs, ys []float64, degree int) ([]float64, bool) {
+	n := degree + 1
+	if len(xs) < n {
+		return nil, false
+	}
+
+	// normal equations : augmented matrix of n x (n+1)
+	matrix := make([][]float64, n)
+	for i := range matrix {
+		matrix[i] = make([]float64, n+1)
+	}
+	for k, x := range xs {
+		powers := make([]float64, 2*n)
+		powers[0] = 1
+		for i := 1; i < len(powers); i++ {
+			powers[i] = powers[i-1] * x
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				matrix[i][j] += powers[i+j]
+			}
+			matrix[i][n] += powers[i] * ys[k]
+		}
+	}
+
+	return solveLinear(matrix)
+}
+
+// evalPolynomial returns c[0] + c[1]x + c[2]x^2 ...
+func evalPolynomial(coefficients []float64, x float64) float64 {
+	y := 0.0
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y = y*x + coefficients[i]
+	}
+	return y
+}
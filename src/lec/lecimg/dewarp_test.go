@@ -0,0 +1,104 @@
+package lecimg
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// createCurvedPage draws lines of words which bend up towards the right edge
+// and spread from the centre like a page near the spine.
+func createCurvedPage(curve float64) *image.RGBA {
+	width, height := 400, 300
+	img := CreateImage(width, height, color.White)
+	for line := 0; line < 8; line++ {
+		baseY := 40 + line*30
+		for x := 20; x < width-20; x++ {
+			if x%40 >= 32 {
+				continue // space between words
+			}
+			t := float64(x) / float64(width)
+			y := baseY - int(curve*t*t*t*float64(baseY+100)/float64(height))
+			FillRect(img, x, y, x+1, y+10, color.Black)
+		}
+	}
+	return img
+}
+
+// lineBendings returns the max difference of centre y of each line between word columns.
+func lineBendings(img image.Image) float64 {
+	bounds := img.Bounds()
+	max := 0.0
+	for line := 0; line < 8; line++ {
+		minY, maxY := math.MaxFloat64, 0.0
+		for x := 30; x < bounds.Dx()-30; x += 40 {
+			sum, count := 0.0, 0.0
+			for y := 40 + line*30 - 30; y < 40+line*30+25; y++ {
+				if y >= 0 && y < bounds.Dy() && isDark(img, x, y) {
+					sum += float64(y)
+					count++
+				}
+			}
+			if count > 0 {
+				minY, maxY = math.Min(minY, sum/count), math.Max(maxY, sum/count)
+			}
+		}
+		max = math.Max(max, maxY-minY)
+	}
+	return max
+}
+
+func TestDewarp(t *testing.T) {
+	page := createCurvedPage(20)
+	before := lineBendings(page)
+	if before < 12 {
+		t.Fatalf("test page is not curved. bending=%v", before)
+	}
+
+	for _, model := range []string{DewarpModelCylinder, DewarpModelPolynomial} {
+		result := runTestFilter(t, NewDewarpFilter(DewarpOption{Threshold: 128, Model: model}), page).(DewarpResult)
+		if !result.dewarped || result.lines != 8 {
+			t.Errorf("%v : page should be dewarped. lines=%v, max=%v", model, result.lines, result.maxDisplacement)
+			continue
+		}
+		if after := lineBendings(result.Img()); after > before/5 {
+			t.Errorf("%v : lines should be straight. before=%v, after=%v", model, before, after)
+		}
+		if again := runTestFilter(t, NewDewarpFilter(DewarpOption{Threshold: 128, Model: model}), page).(DewarpResult); !sameImage(again.Img(), result.Img()) {
+			t.Errorf("%v : result should be the same on every run", model)
+		}
+	}
+}
+
+func TestDewarpStraightPage(t *testing.T) {
+	page := createCurvedPage(0)
+	if result := runTestFilter(t, NewDewarpFilter(DewarpOption{Threshold: 128}), page).(DewarpResult); result.dewarped || result.Img() != page {
+		t.Errorf("straight page should be left alone. max=%v", result.maxDisplacement)
+	}
+
+	blank := CreateImage(100, 100, color.White)
+	if result := runTestFilter(t, NewDewarpFilter(DewarpOption{Threshold: 128}), blank).(DewarpResult); result.dewarped {
+		t.Errorf("blank page should be left alone")
+	}
+}
+
+func TestFitPolynomial(t *testing.T) {
+	xs := []float64{-1, -0.5, 0, 0.5, 1}
+	ys := make([]float64, len(xs))
+	for i, x := range xs {
+		ys[i] = 3 - 2*x + 0.5*x*x
+	}
+	coefficients, ok := fitPolynomial(xs, ys, 2)
+	if !ok {
+		t.Fatalf("fit failed")
+	}
+	for i, expected := range []float64{3, -2, 0.5} {
+		if math.Abs(coefficients[i]-expected) > 1e-9 {
+			t.Errorf("coefficients mismatch. expected=%v, actual=%v", expected, coefficients)
+		}
+	}
+	if _, ok := fitPolynomial(xs[:2], ys[:2], 2); ok {
+		t.Errorf("fit should fail with too few points")
+	}
+}
@@ -16,6 +16,11 @@ func isImage(ext string) bool {
 	return ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".gif"
 }
 
+// IsImageFile checks if the file is a supported image file by its extension.
+func IsImageFile(filename string) bool {
+	return isImage(lecio.GetExt(filename))
+}
+
 // ListImages lists image files in the given directory.
 // Files are sorted by filename in ascending order.
 func ListImages(dir string) ([]os.FileInfo, error) {
@@ -4,9 +4,25 @@ import "image"
 
 // FilterSource is a source of filter
 type FilterSource struct {
-	image    image.Image
-	filename string
-	index    int
+	image     image.Image
+	filename  string // filename of the page, e.g. "p01-002.jpg" for a page split from "p01.jpg"
+	index     int    // index of the source page in the book
+	pageCount int
+
+	// order of the page among the pages split from the source page.
+	// subCount is 1 or less if the source page is not split.
+	subIndex int
+	subCount int
+
+	// true if the page is processed to be analyzed. filters should not write files then.
+	analysis bool
+
+	// size of the device screen. 0 if unknown.
+	deviceWidth  int
+	deviceHeight int
+
+	// jpeg quality of page files which filters write. 0 if unknown.
+	pageQuality int
 }
 
 // NewFilterSource creates an instance of FilterSource
@@ -14,13 +30,84 @@ func NewFilterSource(image image.Image, filename string, index int) *FilterSourc
 	return &FilterSource{image: image, filename: filename, index: index}
 }
 
+// parityIndex returns the index whose parity makes even and odd pages.
+// Pages split from one source page alternate from the first one,
+// e.g. the left and right pages of a spread.
+func (s *FilterSource) parityIndex() int {
+	if s.subCount > 1 {
+		return s.subIndex
+	}
+	return s.index
+}
+
+// debugOutputDir returns dir of debug images, or empty in the analysis pass
+// so that debug images are written once.
+func (s *FilterSource) debugOutputDir(dir string) string {
+	if s.analysis {
+		return ""
+	}
+	return dir
+}
+
 // FilterResult is a result of filter operation
 type FilterResult interface {
 	Img() image.Image
 	Log()
 }
 
-// Filter is an interface for filter operation
+// MultiPageResult is a FilterResult which emits zero or more pages
+// from one source page. Img returns the first page or nil if there is none.
+type MultiPageResult interface {
+	FilterResult
+	Imgs() []image.Image
+}
+
+// resultImages returns the pages of the result.
+func resultImages(result FilterResult) []image.Image {
+	if multi, ok := result.(MultiPageResult); ok {
+		return multi.Imgs()
+	}
+	return []image.Image{result.Img()}
+}
+
+// Filter is an interface for filter operation.
+// Run returns an error if the filter failed to process the source image.
 type Filter interface {
-	Run(src *FilterSource) FilterResult
+	Run(src *FilterSource) (FilterResult, error)
+}
+
+// BookFilter is a Filter which analyzes every page of a book before
+// processing any of them.
+type BookFilter interface {
+	Filter
+
+	// NeedsAnalysis returns true if the analysis pass is required.
+	NeedsAnalysis() bool
+
+	// Analyze inspects a page in the analysis pass.
+	// It may be called concurrently.
+	Analyze(src *FilterSource) error
+
+	// EndAnalysis is called once after every page is analyzed.
+	EndAnalysis()
+}
+
+// MultiPassFilter is a BookFilter which analyzes every page in several passes,
+// e.g. to find edges with the threshold locked by the previous pass.
+// EndAnalysis is called after each pass.
+type MultiPassFilter interface {
+	BookFilter
+
+	// AnalysisPasses returns the number of analysis passes.
+	AnalysisPasses() int
+}
+
+// DeviceFilter is a Filter which works on pages of the device size,
+// e.g. to quantize the dots shown on the device.
+// The pipeline fits pages to the device before running it if the device size is set.
+type DeviceFilter interface {
+	Filter
+
+	// NeedsDeviceSize returns true if pages should be fitted to the device first.
+	NeedsDeviceSize() bool
 }
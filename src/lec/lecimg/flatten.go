@@ -0,0 +1,281 @@
+package lecimg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// background estimation methods of FlattenFilter
+const (
+	FlattenMethodClose = "close"
+	FlattenMethodBlur  = "blur"
+)
+
+const defaultFlattenRadiusRate = 0.05
+
+type FlattenOption struct {
+	Method     string  // "close"(default) : removes dark text before blurring, "blur" : blurs only
+	Radius     int     // radius of the background estimation in pixels. RadiusRate is used if 0
+	RadiusRate float32 // radius as rate of the shorter side of the page (default: 0.05)
+}
+
+func NewFlattenOption(m map[string]interface{}) (*FlattenOption, error) {
+	option := FlattenOption{}
+
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+	if err := option.validate(); err != nil {
+		return nil, err
+	}
+
+	return &option, nil
+}
+
+func (o FlattenOption) validate() error {
+	switch o.Method {
+	case "", FlattenMethodClose, FlattenMethodBlur:
+	default:
+		return fmt.Errorf("invalid flatten method : %v", o.Method)
+	}
+	if o.Radius < 0 || o.RadiusRate < 0 || o.RadiusRate > 0.5 {
+		return fmt.Errorf("invalid flatten radius : radius=%v, radiusRate=%v", o.Radius, o.RadiusRate)
+	}
+	return nil
+}
+
+func (o FlattenOption) withDefaults() FlattenOption {
+	if o.Method == "" {
+		o.Method = FlattenMethodClose
+	}
+	if o.RadiusRate == 0 {
+		o.RadiusRate = defaultFlattenRadiusRate
+	}
+	return o
+}
+
+type FlattenResult struct {
+	image image.Image
+}
+
+func (r FlattenResult) Img() image.Image {
+	return r.image
+}
+
+func (r FlattenResult) Log() {
+}
+
+// ----------------------------------------------------------------------------
+
+// FlattenFilter evens out uneven lighting such as dark corners of photographs.
+// It estimates the background brightness and divides it out,
+// so that the background becomes uniform white.
+type FlattenFilter struct {
+	option FlattenOption
+}
+
+func NewFlattenFilter(option FlattenOption) *FlattenFilter {
+	return &FlattenFilter{option: option.withDefaults()}
+}
+
+func init() {
+	RegisterFilter("flatten", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewFlattenOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewFlattenFilter(*option), nil
+	})
+}
+
+// Implements Filter.Run()
+func (f FlattenFilter) Run(s *FilterSource) (FilterResult, error) {
+	return FlattenResult{flatten(s.image, f.option)}, nil
+}
+
+// flattenedImage returns the image for detection of filters.
+// Lighting is flattened if option is not nil.
+func flattenedImage(src image.Image, option *FlattenOption) image.Image {
+	if option == nil {
+		return src
+	}
+	return flatten(src, option.withDefaults())
+}
+
+// flatten divides each dot by the background brightness.
+// *image.Gray images stay *image.Gray. Bounds of the returned image starts at (0, 0).
+func flatten(src image.Image, o FlattenOption) image.Image {
+	gray := grayImage(src)
+	gray.Rect = gray.Rect.Sub(gray.Rect.Min)
+	bounds := gray.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return src
+	}
+
+	radius := o.Radius
+	if radius == 0 {
+		radius = int(float32(Min(width, height)) * o.RadiusRate)
+	}
+	background := estimateBackground(gray, Max(1, radius), o.Method)
+
+	gain := func(x, y int) float32 {
+		return 255 / float32(Max(1, int(background[y*width+x])))
+	}
+	scale := func(v uint32, gain float32) uint8 {
+		return uint8(Minf32(255, float32(v>>8)*gain+0.5))
+	}
+
+	srcBounds := src.Bounds()
+	if _, ok := src.(*image.Gray); ok {
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				i := y*gray.Stride + x
+				gray.Pix[i] = uint8(Minf32(255, float32(gray.Pix[i])*gain(x, y)+0.5))
+			}
+		}
+		return gray
+	}
+
+	dest := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, a := src.At(srcBounds.Min.X+x, srcBounds.Min.Y+y).RGBA()
+			k := gain(x, y)
+			dest.SetRGBA(x, y, color.RGBA{scale(r, k), scale(g, k), scale(b, k), uint8(a >> 8)})
+		}
+	}
+	return dest
+}
+
+// estimateBackground returns the background brightness of each dot.
+// The page is reduced by the max of blocks so that the filters run on a small grid,
+// then closed (max and min filters) to remove dark text if method is "close",
+// blurred and enlarged by linear interpolation.
+func estimateBackground(gray *image.Gray, radius int, method string) []uint8 {
+	bounds := gray.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// the grid has padding of the filter radius so that the close filter
+	// does not brighten the edges of the page
+	block := Max(1, radius/4)
+	gridRadius := Max(1, (radius+block-1)/block)
+	padding := gridRadius
+	if method != FlattenMethodClose {
+		padding = 0
+	}
+	gridWidth := (width+block-1)/block + padding*2
+	gridHeight := (height+block-1)/block + padding*2
+	grid := make([]int, gridWidth*gridHeight)
+	for i := range grid {
+		grid[i] = noValue
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := (y/block+padding)*gridWidth + x/block + padding
+			grid[i] = Max(grid[i], int(gray.Pix[y*gray.Stride+x]))
+		}
+	}
+
+	if method == FlattenMethodClose {
+		grid = filterGrid(grid, gridWidth, gridHeight, gridRadius, maxOf)
+		grid = filterGrid(grid, gridWidth, gridHeight, gridRadius, minOf)
+		grid = filterGrid(grid, gridWidth, gridHeight, 1, averageOf)
+	} else {
+		grid = filterGrid(grid, gridWidth, gridHeight, gridRadius, averageOf)
+	}
+
+	// linear interpolation between centres of blocks
+	background := make([]uint8, width*height)
+	at := func(x, y int) float32 {
+		x = Max(padding, Min(gridWidth-padding-1, x+padding))
+		y = Max(padding, Min(gridHeight-padding-1, y+padding))
+		return float32(grid[y*gridWidth+x])
+	}
+	for y := 0; y < height; y++ {
+		gy := (float32(y)+0.5)/float32(block) - 0.5
+		y0 := int(Floorf32(gy))
+		ty := gy - float32(y0)
+		for x := 0; x < width; x++ {
+			gx := (float32(x)+0.5)/float32(block) - 0.5
+			x0 := int(Floorf32(gx))
+			tx := gx - float32(x0)
+			top := at(x0, y0)*(1-tx) + at(x0+1, y0)*tx
+			bottom := at(x0, y0+1)*(1-tx) + at(x0+1, y0+1)*tx
+			background[y*width+x] = uint8(top*(1-ty) + bottom*ty + 0.5)
+		}
+	}
+	return background
+}
+
+// noValue marks grid cells out of the page. filters of the grid ignore them.
+const noValue = -1
+
+// maxOf, minOf and averageOf reduce values in the window of filterGrid.
+// They return noValue if the window has no value.
+func maxOf(values []int) int {
+	max := noValue
+	for _, v := range values {
+		if v != noValue && (max == noValue || v > max) {
+			max = v
+		}
+	}
+	return max
+}
+
+func minOf(values []int) int {
+	min := noValue
+	for _, v := range values {
+		if v != noValue && (min == noValue || v < min) {
+			min = v
+		}
+	}
+	return min
+}
+
+func averageOf(values []int) int {
+	sum, count := 0, 0
+	for _, v := range values {
+		if v != noValue {
+			sum += v
+			count++
+		}
+	}
+	if count == 0 {
+		return noValue
+	}
+	return (sum + count/2) / count
+}
+
+// filterGrid applies the separable filter of the square window to the grid.
+// The window is clipped at the edges.
+func filterGrid(grid []int, width, height, radius int, reduce func([]int) int) []int {
+	window := make([]int, 0, 2*radius+1)
+
+	rows := make([]int, len(grid))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			window = window[:0]
+			for i := Max(0, x-radius); i <= Min(width-1, x+radius); i++ {
+				window = append(window, grid[y*width+i])
+			}
+			rows[y*width+x] = reduce(window)
+		}
+	}
+
+	dest := make([]int, len(grid))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			window = window[:0]
+			for i := Max(0, y-radius); i <= Min(height-1, y+radius); i++ {
+				window = append(window, rows[i*width+x])
+			}
+			dest[y*width+x] = reduce(window)
+		}
+	}
+	return dest
+}
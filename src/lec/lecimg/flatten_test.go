@@ -0,0 +1,96 @@
+package lecimg
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// createUnevenPage draws a text block on a page lit brightly at the centre
+// and dimly at the corners.
+func createUnevenPage() *image.RGBA {
+	width, height := 300, 400
+	img := CreateImage(width, height, color.White)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dx, dy := float64(x-width/2)/float64(width/2), float64(y-height/2)/float64(height/2)
+			light := 1 - 0.45*(dx*dx+dy*dy)/2
+			v := 250.0
+			if x >= 100 && x < 200 && y >= 150 && y < 250 && (y/10)%2 == 0 {
+				v = 30 // text lines
+			}
+			img.Set(x, y, color.Gray{uint8(v * light)})
+		}
+	}
+	return img
+}
+
+func TestFlatten(t *testing.T) {
+	src := createUnevenPage()
+	if v := grayAt(src, 0, 0); v > 160 {
+		t.Fatalf("corners of test page should be dark. actual=%v", v)
+	}
+
+	for _, method := range []string{FlattenMethodClose, FlattenMethodBlur} {
+		img := runTestFilter(t, NewFlattenFilter(FlattenOption{Method: method}), src).Img()
+		// blur is biased at the edges by the clipped window
+		white := uint8(240)
+		if method == FlattenMethodBlur {
+			white = 225
+		}
+		for _, p := range []image.Point{{0, 0}, {299, 0}, {0, 399}, {299, 399}, {150, 50}, {50, 200}} {
+			if v := grayAt(img, p.X, p.Y); v < white {
+				t.Errorf("%v : background should be white at %v. actual=%v", method, p, v)
+			}
+		}
+		if v := grayAt(img, 150, 165); method == FlattenMethodClose && v > 60 {
+			t.Errorf("%v : text should stay dark. actual=%v", method, v)
+		}
+	}
+}
+
+func TestFlattenGray(t *testing.T) {
+	src := grayImage(createUnevenPage())
+	result := runTestFilter(t, NewFlattenFilter(FlattenOption{Radius: 20}), src)
+	gray, ok := result.Img().(*image.Gray)
+	if !ok {
+		t.Fatalf("gray page should stay gray. actual=%T", result.Img())
+	}
+	if v := gray.GrayAt(0, 0).Y; v < 235 {
+		t.Errorf("background should be white. actual=%v", v)
+	}
+	if src.GrayAt(0, 0).Y == gray.GrayAt(0, 0).Y {
+		t.Errorf("source should not be modified")
+	}
+}
+
+func TestFlattenDetection(t *testing.T) {
+	src := createUnevenPage()
+
+	// dark corners are regarded as content without flatten
+	option := AutoCropOption{Threshold: 200, MinRatio: 0.1, MaxRatio: 10, MaxWidthCropRate: 1, MaxHeightCropRate: 1}
+	result := runTestFilter(t, NewAutoCropFilter(option), src)
+	if rect := result.(AutoCropResult).rect; rect != src.Bounds() {
+		t.Fatalf("page should not be cropped without flatten. actual=%v", rect)
+	}
+
+	option.Flatten = &FlattenOption{}
+	result = runTestFilter(t, NewAutoCropFilter(option), src)
+	if rect := result.(AutoCropResult).rect; rect != image.Rect(100, 160, 200, 250) {
+		t.Errorf("text block should be cropped with flatten. actual=%v", rect)
+	}
+	// output dots are not flattened
+	cropped := result.Img()
+	if math.Abs(float64(grayAt(cropped, cropped.Bounds().Min.X, cropped.Bounds().Max.Y-1))-
+		float64(grayAt(src, 100, 249))) > 1 {
+		t.Errorf("output should keep source dots")
+	}
+}
+
+func TestFlattenOption(t *testing.T) {
+	option, err := NewDeskewOption(map[string]interface{}{"flatten": map[string]interface{}{"radius": 30}})
+	if err != nil || option.Flatten == nil || option.Flatten.Radius != 30 {
+		t.Errorf("nested flatten option should be decoded. actual=%v, %v", option, err)
+	}
+}
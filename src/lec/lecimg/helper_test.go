@@ -0,0 +1,49 @@
+package lecimg
+
+import (
+	"image"
+	"testing"
+)
+
+// runTestFilter runs the filter on the image and stops the test if it fails.
+func runTestFilter(t *testing.T, filter Filter, img image.Image) FilterResult {
+	return runTestFilterSource(t, filter, NewFilterSource(img, "filename", 0))
+}
+
+// runTestFilterSource runs the filter on the source and stops the test if it fails.
+func runTestFilterSource(t *testing.T, filter Filter, s *FilterSource) FilterResult {
+	result, err := filter.Run(s)
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
+	return result
+}
+
+// grayAt returns the brightness of the pixel as detection filters see it.
+func grayAt(img image.Image, x, y int) uint8 {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return uint8(getBrightness(r, g, b) >> 8)
+}
+
+// isDark returns true if the pixel is darker than mid-grey.
+func isDark(img image.Image, x, y int) bool {
+	return grayAt(img, x, y) < 128
+}
+
+// sameImage checks whether both images have the same size and colors.
+func sameImage(a, b image.Image) bool {
+	ab, bb := a.Bounds(), b.Bounds()
+	if ab.Dx() != bb.Dx() || ab.Dy() != bb.Dy() {
+		return false
+	}
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			r1, g1, b1, a1 := a.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+			r2, g2, b2, a2 := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"image"
 	"image/color"
+	"image/draw"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
@@ -79,12 +80,65 @@ func SaveJpeg(img image.Image, dir string, filename string, quality int) error {
 		file.Close()
 	}()
 
-	return jpeg.Encode(file, img, &jpeg.Options{Quality: quality})
+	return jpeg.Encode(file, jpegImage(img), &jpeg.Options{Quality: quality})
+}
+
+// SavePng writes image as png file.
+func SavePng(img image.Image, dir string, filename string) error {
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(filepath.Join(dir, filename))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		file.Close()
+	}()
+
+	return png.Encode(file, img)
+}
+
+// DefaultPageQuality is the jpeg quality of output pages.
+const DefaultPageQuality = 80
+
+// SavePage writes a page of the output. Quantized pages are written as png
+// so that their grey levels are kept. Other pages are written as jpeg of the quality.
+// The extension of filename is replaced and the written filename is returned.
+func SavePage(img image.Image, dir string, filename string, quality int) (string, error) {
+	filename = lecio.GetBaseWithoutExt(filename)
+	if IsLosslessImage(img) {
+		filename += ".png"
+		return filename, SavePng(img, dir, filename)
+	}
+	filename += ".jpg"
+	return filename, SaveJpeg(img, dir, filename, quality)
+}
+
+// IsLosslessImage returns true if the page should be stored without loss.
+// Only pages of QuantizeFilter are, other gray pages are smaller as jpeg.
+func IsLosslessImage(img image.Image) bool {
+	switch img.(type) {
+	case *QuantizedGray, *image.Paletted:
+		return true
+	}
+	return false
+}
+
+func ToPngBytes(img image.Image) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := png.Encode(buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 func ToJpegBytes(img image.Image, quality int) ([]byte, error) {
 	buf := new(bytes.Buffer)
-	err := jpeg.Encode(buf, img, &jpeg.Options{Quality: quality})
+	err := jpeg.Encode(buf, jpegImage(img), &jpeg.Options{Quality: quality})
 	if err != nil {
 		return nil, err
 	}
@@ -92,6 +146,24 @@ func ToJpegBytes(img image.Image, quality int) ([]byte, error) {
 
 }
 
+// jpegImage converts paletted image of grey colors to gray image
+// so that jpeg stores a single channel.
+func jpegImage(img image.Image) image.Image {
+	paletted, ok := img.(*image.Paletted)
+	if !ok {
+		return img
+	}
+	for _, c := range paletted.Palette {
+		if r, g, b, _ := c.RGBA(); r != g || g != b {
+			return img
+		}
+	}
+
+	gray := image.NewGray(paletted.Bounds())
+	draw.Draw(gray, gray.Bounds(), paletted, paletted.Bounds().Min, draw.Src)
+	return gray
+}
+
 // CreateImage creates an image with given size and background color.
 func CreateImage(width, height int, bgColor color.Color) *image.RGBA {
 	img := image.NewRGBA(image.Rect(0, 0, width, height))
@@ -112,6 +184,23 @@ func FillRect(img *image.RGBA, x1, y1, x2, y2 int, rectColor color.Color) {
 	}
 }
 
+// DrawRect draws an outline of rectangle.
+func DrawRect(img *image.RGBA, rect image.Rectangle, rectColor color.Color) {
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		img.Set(x, rect.Min.Y, rectColor)
+		img.Set(x, rect.Max.Y-1, rectColor)
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		img.Set(rect.Min.X, y, rectColor)
+		img.Set(rect.Max.X-1, y, rectColor)
+	}
+}
+
+// BlendRect blends a translucent color over rectangle.
+func BlendRect(img *image.RGBA, rect image.Rectangle, rectColor color.NRGBA) {
+	draw.Draw(img, rect, &image.Uniform{rectColor}, image.ZP, draw.Over)
+}
+
 // DrawLine draw a line.
 func DrawLine(img *image.RGBA, x1, y1, x2, y2 int, lineColor color.Color) {
 	dx, dy := x2-x1, y2-y1
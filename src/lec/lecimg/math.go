@@ -34,6 +34,14 @@ func Maxf32(x, y float32) float32 {
 	return y
 }
 
+// Absf32 returns absolute value
+func Absf32(x float32) float32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
 // Sincosf32 returns sin, cos values
 func Sincosf32(a float32) (float32, float32) {
 	sin, cos := math.Sincos(math.Pi * float64(a) / 180)
@@ -55,3 +63,37 @@ func InRangef32(value, rangeFrom, rangeTo float32) bool {
 func InRange(value, rangeFrom, rangeTo int) bool {
 	return rangeFrom <= value && value <= rangeTo
 }
+
+// solveLinear solves linear equations given as the augmented matrix of n x (n+1)
+// by gaussian elimination with partial pivoting. The matrix is modified.
+// It returns false if the equations have no unique solution.
+func solveLinear(matrix [][]float64) ([]float64, bool) {
+	n := len(matrix)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(matrix[row][col]) > math.Abs(matrix[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(matrix[pivot][col]) < 1e-12 {
+			return nil, false
+		}
+		matrix[col], matrix[pivot] = matrix[pivot], matrix[col]
+		for row := 0; row < n; row++ {
+			if row == col {
+				continue
+			}
+			factor := matrix[row][col] / matrix[col][col]
+			for j := col; j <= n; j++ {
+				matrix[row][j] -= factor * matrix[col][j]
+			}
+		}
+	}
+
+	solution := make([]float64, n)
+	for i := range solution {
+		solution[i] = matrix[i][n] / matrix[i][i]
+	}
+	return solution, true
+}
@@ -0,0 +1,271 @@
+package lecimg
+
+import (
+	"fmt"
+	"image"
+	"log"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+const defaultOrientMinConfidence = 0.2
+
+type OrientOption struct {
+	Threshold     uint8   // min brightness of space (0~255)
+	AutoThreshold bool    // selects Threshold of each page by Otsu's method ("threshold: auto")
+	LockThreshold bool    // uses one auto threshold for the book
+	MinConfidence float32 // pages are rotated only if confidence >= value (0~1, default: 0.2)
+	Rotations     []int   // allowed rotations in degrees counter-clockwise (default: 90, 180, 270)
+}
+
+func NewOrientOption(m map[string]interface{}) (*OrientOption, error) {
+	option := OrientOption{}
+
+	m, auto := parseAutoThreshold(m)
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+	option.AutoThreshold = option.AutoThreshold || auto
+
+	if option.MinConfidence < 0 || option.MinConfidence > 1 {
+		return nil, fmt.Errorf("invalid minConfidence : %v", option.MinConfidence)
+	}
+	for _, rotation := range option.Rotations {
+		if rotation != 90 && rotation != 180 && rotation != 270 {
+			return nil, fmt.Errorf("invalid rotation : %v", rotation)
+		}
+	}
+
+	return &option, nil
+}
+
+type OrientResult struct {
+	thresholdResult
+	image      image.Image
+	rotation   int     // detected rotation to correct the page
+	confidence float32 // 0~1
+	rotated    bool
+}
+
+func (r OrientResult) Img() image.Image {
+	return r.image
+}
+
+func (r OrientResult) Log() {
+	r.logThreshold()
+	if r.rotated {
+		log.Printf("[ORIENT] %v : %v (confidence %.2f)\n", r.filename, r.rotation, r.confidence)
+	} else if r.rotation != 0 {
+		log.Printf("[ORIENT] %v : %v skipped (confidence %.2f)\n", r.filename, r.rotation, r.confidence)
+	}
+}
+
+func (r OrientResult) Report(report *PageReport) {
+	rotation, confidence := 0, r.confidence
+	if r.rotated {
+		rotation = r.rotation
+	}
+	report.Orientation = &rotation
+	report.OrientConfidence = &confidence
+	r.reportThreshold(report)
+}
+
+// ----------------------------------------------------------------------------
+
+// OrientFilter detects pages fed sideways or upside down from the structure
+// of text lines and rotates them by a multiple of 90 degrees.
+type OrientFilter struct {
+	autoThresholdFilter
+	option OrientOption
+}
+
+func NewOrientFilter(option OrientOption) *OrientFilter {
+	if option.MinConfidence == 0 {
+		option.MinConfidence = defaultOrientMinConfidence
+	}
+	if len(option.Rotations) == 0 {
+		option.Rotations = []int{90, 180, 270}
+	}
+
+	return &OrientFilter{
+		option:              option,
+		autoThresholdFilter: autoThresholdFilter{newAutoThreshold(option.AutoThreshold, option.LockThreshold)},
+	}
+}
+
+func init() {
+	RegisterFilter("orient", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewOrientOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewOrientFilter(*option), nil
+	})
+}
+
+// Implements Filter.Run()
+func (f OrientFilter) Run(s *FilterSource) (FilterResult, error) {
+	if f.threshold.enabled() {
+		f.option.Threshold = f.threshold.get(s.image)
+	}
+	threshold := thresholdResult{s.filename, f.threshold.enabled(), f.option.Threshold}
+
+	rotation, confidence := f.detectOrientation(s.image)
+	if rotation == 0 || confidence < f.option.MinConfidence || !f.allows(rotation) {
+		return OrientResult{threshold, s.image, rotation, confidence, false}, nil
+	}
+	return OrientResult{threshold, RotateImage90(s.image, rotation), rotation, confidence, true}, nil
+}
+
+func (f OrientFilter) allows(rotation int) bool {
+	for _, r := range f.option.Rotations {
+		if r == rotation {
+			return true
+		}
+	}
+	return false
+}
+
+// detectOrientation returns the counter-clockwise rotation to correct the page
+// and its confidence.
+//
+// Text lines make the projection profile across the lines uneven,
+// so the axis with more projection energy is across the lines.
+// Ascenders are more frequent than descenders in latin text,
+// so the side of the lines with more dots outside the x-height band is the top.
+// Other scripts such as CJK have no such band, so the top is a guess for them.
+// The confidence is the smaller of both scores, and for upside down pages
+// also the rate of lines agreeing on the top.
+func (f OrientFilter) detectOrientation(src image.Image) (int, float32) {
+	rows, columns := projectionProfiles(src, f.option.Threshold)
+	if len(rows) == 0 {
+		return 0, 0
+	}
+
+	rowEnergy, columnEnergy := profileEnergy(rows), profileEnergy(columns)
+	if rowEnergy+columnEnergy == 0 {
+		return 0, 0
+	}
+	axis := (rowEnergy - columnEnergy) / (rowEnergy + columnEnergy)
+
+	if axis >= 0 {
+		// horizontal lines. turning an upright page upside down is worse than
+		// leaving an upside down page, so most lines should agree on it.
+		asymmetry, agreement := lineAsymmetry(rows)
+		confidence := Minf32(axis, Absf32(asymmetry))
+		if asymmetry >= 0 {
+			return 0, confidence
+		}
+		return 180, Minf32(confidence, agreement)
+	}
+
+	// vertical lines. the top of the lines is right if the page was turned clockwise.
+	for i, j := 0, len(columns)-1; i < j; i, j = i+1, j-1 {
+		columns[i], columns[j] = columns[j], columns[i]
+	}
+	asymmetry, _ := lineAsymmetry(columns)
+	confidence := Minf32(-axis, Absf32(asymmetry))
+	if asymmetry >= 0 {
+		return 90, confidence
+	}
+	return 270, confidence
+}
+
+// projectionProfiles returns dark dot counts of rows and columns
+// inside the bounding box of dark dots.
+func projectionProfiles(src image.Image, threshold uint8) ([]int, []int) {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	thresholdSum := uint32(threshold) * 256 * 3
+	rows := make([]int, height)
+	columns := make([]int, width)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if r, g, b, _ := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA(); r+g+b < thresholdSum {
+				rows[y]++
+				columns[x]++
+			}
+		}
+	}
+	return trimProfile(rows), trimProfile(columns)
+}
+
+// trimProfile removes empty entries at both ends.
+func trimProfile(profile []int) []int {
+	start, end := 0, len(profile)
+	for start < end && profile[start] == 0 {
+		start++
+	}
+	for end > start && profile[end-1] == 0 {
+		end--
+	}
+	return profile[start:end]
+}
+
+// profileEnergy returns how much the profile is concentrated compared to a flat one.
+// It is 0 for a flat profile.
+func profileEnergy(profile []int) float32 {
+	var sum, squareSum float64
+	for _, v := range profile {
+		sum += float64(v)
+		squareSum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return 0
+	}
+	return float32(float64(len(profile))*squareSum/(sum*sum) - 1)
+}
+
+// lineAsymmetry returns the rate of dots above the dense band of the lines
+// minus the rate of dots below it (-1~1), and the rate of lines whose own
+// asymmetry has the same sign minus the rate of the others (0~1).
+// Lines are separated by empty entries.
+func lineAsymmetry(profile []int) (float32, float32) {
+	above, below := 0, 0
+	votes, lines := 0, 0
+	for start := 0; start < len(profile); {
+		if profile[start] == 0 {
+			start++
+			continue
+		}
+		end, peak := start, 0
+		for ; end < len(profile) && profile[end] > 0; end++ {
+			peak = Max(peak, profile[end])
+		}
+
+		bandStart, bandEnd := start, end-1
+		for profile[bandStart]*2 < peak {
+			bandStart++
+		}
+		for profile[bandEnd]*2 < peak {
+			bandEnd--
+		}
+		lineAbove, lineBelow := 0, 0
+		for i := start; i < bandStart; i++ {
+			lineAbove += profile[i]
+		}
+		for i := bandEnd + 1; i < end; i++ {
+			lineBelow += profile[i]
+		}
+		if lineAbove > lineBelow {
+			votes++
+		} else if lineAbove < lineBelow {
+			votes--
+		}
+		above += lineAbove
+		below += lineBelow
+		lines++
+		start = end
+	}
+
+	if above+below == 0 {
+		return 0, 0
+	}
+	asymmetry := float32(above-below) / float32(above+below)
+	if asymmetry < 0 {
+		votes = -votes
+	}
+	return asymmetry, Maxf32(0, float32(votes)/float32(lines))
+}
@@ -0,0 +1,96 @@
+package lecimg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+var orientTestText = []string{
+	"The quick brown fox jumps over the lazy dog and",
+	"keeps running along the riverbank until night",
+	"falls. Pages fed sideways or upside down should",
+	"be turned back before cropping and deskewing by",
+	"looking at the shape of text lines on the page.",
+	"Typography has ascenders like b, d, f, h, k, l",
+	"and descenders like g, j, p, q, y below lines.",
+}
+
+func createTextPage() *image.RGBA {
+	img := CreateImage(500, 300, color.White)
+	for i, line := range orientTestText {
+		DrawLabelBold8x16(img, 40, 50+i*28, line, color.Black)
+	}
+	return img
+}
+
+func TestOrient(t *testing.T) {
+	page := createTextPage()
+	for _, angle := range []int{90, 180, 270} {
+		result := runTestFilter(t, NewOrientFilter(OrientOption{Threshold: 128}), RotateImage90(page, angle)).(OrientResult)
+		if !result.rotated || result.rotation != 360-angle {
+			t.Errorf("%v : rotation mismatch. actual=%v, confidence=%v", angle, result.rotation, result.confidence)
+			continue
+		}
+		if !sameImage(result.Img(), page) {
+			t.Errorf("%v : page should be restored", angle)
+		}
+	}
+
+	result := runTestFilter(t, NewOrientFilter(OrientOption{Threshold: 128}), page).(OrientResult)
+	if result.rotated || result.Img() != page {
+		t.Errorf("upright page should not be rotated. actual=%v", result.rotation)
+	}
+	if result.confidence < defaultOrientMinConfidence {
+		t.Errorf("confidence is too low. actual=%v", result.confidence)
+	}
+}
+
+func TestOrientSkipped(t *testing.T) {
+	page := RotateImage90(createTextPage(), 180)
+
+	if result := runTestFilter(t, NewOrientFilter(OrientOption{Threshold: 128, MinConfidence: 0.99}), page).(OrientResult); result.rotated {
+		t.Errorf("page with low confidence should be left alone")
+	}
+	if result := runTestFilter(t, NewOrientFilter(OrientOption{Threshold: 128, Rotations: []int{90, 270}}), page).(OrientResult); result.rotated {
+		t.Errorf("page should not be rotated by disallowed rotation")
+	}
+	if result := runTestFilter(t, NewOrientFilter(OrientOption{Threshold: 128}), CreateImage(100, 100, color.White)).(OrientResult); result.rotated || result.confidence != 0 {
+		t.Errorf("blank page should be left alone")
+	}
+
+	// two lines with many dots below outweigh three lines with a few dots above
+	mixed := CreateImage(400, 300, color.White)
+	for i := 0; i < 5; i++ {
+		y := 30 + i*50
+		FillRect(mixed, 20, y+10, 380, y+20, color.Black)
+		for x := 20; x < 380; x += 4 {
+			if i < 2 {
+				FillRect(mixed, x, y+20, x+1, y+28, color.Black)
+			} else if x%12 == 8 {
+				FillRect(mixed, x, y+6, x+1, y+10, color.Black)
+			}
+		}
+	}
+	if result := runTestFilter(t, NewOrientFilter(OrientOption{Threshold: 128}), mixed).(OrientResult); result.rotated {
+		t.Errorf("page should not be turned upside down unless most lines agree. rotation=%v, confidence=%v",
+			result.rotation, result.confidence)
+	}
+}
+
+func TestRotateImage90(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	copy(img.Pix, []uint8{1, 2, 3, 4, 5, 6})
+
+	rotated := RotateImage90(img, 90)
+	gray, ok := rotated.(*image.Gray)
+	if !ok || gray.Bounds().Dx() != 2 || gray.Bounds().Dy() != 3 {
+		t.Fatalf("rotated image should be 2x3 gray image. actual=%T %v", rotated, rotated.Bounds())
+	}
+	if expected := []uint8{3, 6, 2, 5, 1, 4}; string(gray.Pix) != string(expected) {
+		t.Errorf("pixels mismatch. expected=%v, actual=%v", expected, gray.Pix)
+	}
+	if !sameImage(RotateImage90(rotated, 270), img) {
+		t.Errorf("rotation should be lossless")
+	}
+}
@@ -0,0 +1,318 @@
+package lecimg
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"sort"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// output modes of PanelsFilter
+const (
+	PanelsModeAppend = "append"
+	PanelsModeOnly   = "panelsOnly"
+)
+
+// panel grouping of PanelsFilter
+const (
+	PanelsGroupPanel = "panel"
+	PanelsGroupRow   = "row"
+)
+
+// default values of PanelsOption
+const (
+	defaultPanelsTolerance   = 32
+	defaultPanelsMinAreaRate = 0.01
+)
+
+type PanelsOption struct {
+	Order       string  // "ltr"(default) : left panel first, "rtl" : right panel first (manga)
+	Mode        string  // "append"(default) : panels after the full page, "panelsOnly" : panels only
+	Group       string  // "panel"(default) : a page per panel, "row" : a page per row of panels
+	Tolerance   uint8   // max brightness difference of gutter dots from the border background (default: 32)
+	MinAreaRate float32 // min panel area as rate of the page (default: 0.01)
+	Padding     int     // space around panels in pixels
+}
+
+func NewPanelsOption(m map[string]interface{}) (*PanelsOption, error) {
+	option := PanelsOption{}
+
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validatePageOrder(option.Order); err != nil {
+		return nil, err
+	}
+	switch option.Mode {
+	case "", PanelsModeAppend, PanelsModeOnly:
+	default:
+		return nil, fmt.Errorf("invalid mode : %v", option.Mode)
+	}
+	switch option.Group {
+	case "", PanelsGroupPanel, PanelsGroupRow:
+	default:
+		return nil, fmt.Errorf("invalid group : %v", option.Group)
+	}
+	if option.MinAreaRate < 0 || option.MinAreaRate > 1 || option.Padding < 0 {
+		return nil, fmt.Errorf("invalid minAreaRate or padding : minAreaRate=%v, padding=%v",
+			option.MinAreaRate, option.Padding)
+	}
+
+	return &option, nil
+}
+
+type PanelsResult struct {
+	images   []image.Image
+	filename string
+	panels   int
+}
+
+func (r PanelsResult) Img() image.Image {
+	return r.images[0]
+}
+
+// Implements MultiPageResult.Imgs()
+func (r PanelsResult) Imgs() []image.Image {
+	return r.images
+}
+
+func (r PanelsResult) Log() {
+	if r.panels > 1 {
+		log.Printf("[PANELS] %v : %v panels\n", r.filename, r.panels)
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// PanelsFilter detects comic panels and emits them as extra pages,
+// so that small screens show each panel large enough to read.
+type PanelsFilter struct {
+	option PanelsOption
+}
+
+func NewPanelsFilter(option PanelsOption) *PanelsFilter {
+	if option.Order == "" {
+		option.Order = PageOrderLTR
+	}
+	if option.Mode == "" {
+		option.Mode = PanelsModeAppend
+	}
+	if option.Group == "" {
+		option.Group = PanelsGroupPanel
+	}
+	if option.Tolerance == 0 {
+		option.Tolerance = defaultPanelsTolerance
+	}
+	if option.MinAreaRate == 0 {
+		option.MinAreaRate = defaultPanelsMinAreaRate
+	}
+	return &PanelsFilter{option: option}
+}
+
+func init() {
+	RegisterFilter("panels", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewPanelsOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewPanelsFilter(*option), nil
+	})
+}
+
+// Implements Filter.Run()
+func (f PanelsFilter) Run(s *FilterSource) (FilterResult, error) {
+	src := s.image
+	rows := f.orderPanels(f.findPanels(src))
+
+	count := 0
+	for _, row := range rows {
+		count += len(row)
+	}
+	if count < 2 {
+		return PanelsResult{[]image.Image{src}, s.filename, count}, nil
+	}
+
+	var images []image.Image
+	if f.option.Mode == PanelsModeAppend {
+		images = append(images, src)
+	}
+	bounds := src.Bounds()
+	for _, row := range rows {
+		var rects []image.Rectangle
+		if f.option.Group == PanelsGroupRow {
+			rect := row[0]
+			for _, panel := range row[1:] {
+				rect = rect.Union(panel)
+			}
+			rects = []image.Rectangle{rect}
+		} else {
+			rects = row
+		}
+		for _, rect := range rects {
+			rect = rect.Inset(-f.option.Padding).Add(bounds.Min)
+			images = append(images, cropImage(src, rect))
+		}
+	}
+	return PanelsResult{images, s.filename, count}, nil
+}
+
+// findPanels returns rectangles of panels relative to the page origin.
+// Gutters are flood filled from the page borders with dots close to the
+// background colour of the borders. Connected areas of the other dots
+// are panels, and overlapping panels are merged.
+func (f PanelsFilter) findPanels(src image.Image) []image.Rectangle {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 3 || height < 3 {
+		return nil
+	}
+
+	brightness := make([]uint8, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			brightness[y*width+x] = uint8(getBrightness(r, g, b) >> 8)
+		}
+	}
+
+	// background is the median brightness of the borders
+	var histogram [256]int
+	var borders []int
+	for x := 0; x < width; x++ {
+		borders = append(borders, x, (height-1)*width+x)
+	}
+	for y := 1; y < height-1; y++ {
+		borders = append(borders, y*width, y*width+width-1)
+	}
+	for _, i := range borders {
+		histogram[brightness[i]]++
+	}
+	background, count := 0, 0
+	for count*2 < len(borders) {
+		count += histogram[background]
+		background++
+	}
+	background--
+
+	tolerance := int(f.option.Tolerance)
+	isGutter := func(i int) bool {
+		d := int(brightness[i]) - background
+		return d <= tolerance && d >= -tolerance
+	}
+
+	// flood fill gutters from the borders
+	gutter := make([]bool, width*height)
+	var stack []int
+	for _, i := range borders {
+		if !gutter[i] && isGutter(i) {
+			gutter[i] = true
+			stack = append(stack, i)
+		}
+	}
+	neighbours := func(i int) [4]int {
+		x := i % width
+		n := [4]int{i - width, i + width, -1, -1}
+		if x > 0 {
+			n[2] = i - 1
+		}
+		if x < width-1 {
+			n[3] = i + 1
+		}
+		return n
+	}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, n := range neighbours(i) {
+			if n >= 0 && n < len(gutter) && !gutter[n] && isGutter(n) {
+				gutter[n] = true
+				stack = append(stack, n)
+			}
+		}
+	}
+
+	// bounding boxes of connected areas which are not gutters
+	minArea := int(float32(width*height) * f.option.MinAreaRate)
+	visited := make([]bool, width*height)
+	var panels []image.Rectangle
+	for start := range gutter {
+		if gutter[start] || visited[start] {
+			continue
+		}
+		rect := image.Rect(start%width, start/width, start%width+1, start/width+1)
+		visited[start] = true
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := i%width, i/width
+			rect = rect.Union(image.Rect(x, y, x+1, y+1))
+			for _, n := range neighbours(i) {
+				if n >= 0 && n < len(gutter) && !gutter[n] && !visited[n] {
+					visited[n] = true
+					stack = append(stack, n)
+				}
+			}
+		}
+		if rect.Dx()*rect.Dy() >= minArea {
+			panels = append(panels, rect)
+		}
+	}
+
+	// merge overlapping panels such as balloons over gutters
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(panels) && !merged; i++ {
+			for j := i + 1; j < len(panels); j++ {
+				if panels[i].Overlaps(panels[j]) {
+					panels[i] = panels[i].Union(panels[j])
+					panels = append(panels[:j], panels[j+1:]...)
+					merged = true
+					break
+				}
+			}
+		}
+	}
+	return panels
+}
+
+// orderPanels groups panels into rows from top to bottom and sorts panels
+// of each row by the reading order. A panel joins the row if it overlaps
+// the row vertically by half of the smaller height.
+func (f PanelsFilter) orderPanels(panels []image.Rectangle) [][]image.Rectangle {
+	sort.Slice(panels, func(i, j int) bool {
+		if panels[i].Min.Y != panels[j].Min.Y {
+			return panels[i].Min.Y < panels[j].Min.Y
+		}
+		return panels[i].Min.X < panels[j].Min.X
+	})
+
+	var rows [][]image.Rectangle
+	var rowSpan span
+	for _, panel := range panels {
+		if n := len(rows); n > 0 {
+			overlap := Min(rowSpan.end, panel.Max.Y) - Max(rowSpan.start, panel.Min.Y)
+			if overlap*2 >= Min(rowSpan.end-rowSpan.start, panel.Dy()) {
+				rows[n-1] = append(rows[n-1], panel)
+				rowSpan = span{Min(rowSpan.start, panel.Min.Y), Max(rowSpan.end, panel.Max.Y)}
+				continue
+			}
+		}
+		rows = append(rows, []image.Rectangle{panel})
+		rowSpan = span{panel.Min.Y, panel.Max.Y}
+	}
+
+	for _, row := range rows {
+		sort.Slice(row, func(i, j int) bool {
+			if f.option.Order == PageOrderRTL {
+				return row[i].Max.X > row[j].Max.X
+			}
+			return row[i].Min.X < row[j].Min.X
+		})
+	}
+	return rows
+}
@@ -0,0 +1,90 @@
+package lecimg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// panelsTestRects are two panels, a wide panel and two panels from top to bottom.
+var panelsTestRects = []image.Rectangle{
+	image.Rect(20, 20, 190, 200), image.Rect(210, 20, 380, 200),
+	image.Rect(20, 220, 380, 400),
+	image.Rect(20, 420, 190, 580), image.Rect(210, 420, 380, 580),
+}
+
+// createComicPage draws panels with black borders and a small content mark
+// at the top left of each panel.
+func createComicPage() *image.RGBA {
+	img := CreateImage(400, 600, color.White)
+	for i, rect := range panelsTestRects {
+		FillRect(img, rect.Min.X, rect.Min.Y, rect.Max.X, rect.Max.Y, color.Black)
+		FillRect(img, rect.Min.X+2, rect.Min.Y+2, rect.Max.X-2, rect.Max.Y-2, color.White)
+		FillRect(img, rect.Min.X+10, rect.Min.Y+10, rect.Min.X+20+i*5, rect.Min.Y+20, color.Black)
+	}
+	FillRect(img, 198, 590, 202, 594, color.Black) // page number
+	return img
+}
+
+// markWidth returns the width of the content mark of the panel page.
+func markWidth(img image.Image) int {
+	width := 0
+	for isDark(img, 10+width, 15) {
+		width++
+	}
+	return width
+}
+
+func TestPanels(t *testing.T) {
+	page := createComicPage()
+	result := runTestFilter(t, NewPanelsFilter(PanelsOption{}), page).(PanelsResult)
+	images := result.Imgs()
+	if result.panels != 5 || len(images) != 6 {
+		t.Fatalf("page count mismatch. panels=%v, pages=%v", result.panels, len(images))
+	}
+	if images[0] != image.Image(page) {
+		t.Errorf("full page should be first")
+	}
+	for i, img := range images[1:] {
+		if img.Bounds().Dx() != panelsTestRects[i].Dx() || img.Bounds().Dy() != panelsTestRects[i].Dy() {
+			t.Errorf("panel %v size mismatch. expected=%v, actual=%v", i, panelsTestRects[i], img.Bounds())
+		}
+		if width := markWidth(img); width != 10+i*5 {
+			t.Errorf("panel %v order mismatch. mark width=%v", i, width)
+		}
+	}
+}
+
+func TestPanelsRTL(t *testing.T) {
+	result := runTestFilter(t, NewPanelsFilter(PanelsOption{Order: PageOrderRTL, Mode: PanelsModeOnly}), createComicPage()).(PanelsResult)
+	images := result.Imgs()
+	if len(images) != 5 {
+		t.Fatalf("page count mismatch. pages=%v", len(images))
+	}
+	for i, expected := range []int{1, 0, 2, 4, 3} {
+		if width := markWidth(images[i]); width != 10+expected*5 {
+			t.Errorf("panel %v order mismatch. expected=%v, mark width=%v", i, expected, width)
+		}
+	}
+}
+
+func TestPanelsGroupRow(t *testing.T) {
+	result := runTestFilter(t, NewPanelsFilter(PanelsOption{Group: PanelsGroupRow, Padding: 5}), createComicPage()).(PanelsResult)
+	images := result.Imgs()
+	if len(images) != 4 {
+		t.Fatalf("page count mismatch. pages=%v", len(images))
+	}
+	if bounds := images[1].Bounds(); bounds.Dx() != 370 || bounds.Dy() != 190 {
+		t.Errorf("row size mismatch. actual=%v", bounds)
+	}
+}
+
+func TestPanelsNoPanels(t *testing.T) {
+	img := CreateImage(400, 600, color.White)
+	FillRect(img, 50, 50, 350, 550, color.Gray{100})
+	for _, mode := range []string{PanelsModeAppend, PanelsModeOnly} {
+		if result := runTestFilter(t, NewPanelsFilter(PanelsOption{Mode: mode}), img).(PanelsResult); len(result.Imgs()) != 1 || result.Img() != image.Image(img) {
+			t.Errorf("%v : page with one panel should be left alone. pages=%v", mode, len(result.Imgs()))
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package lecimg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// default values of PerspectiveOption
+const (
+	defaultPerspectiveMinAreaRate   = 0.2
+	defaultPerspectiveMinConfidence = 0.9
+	defaultPerspectiveEdgeTrimRate  = 0.1
+)
+
+type PerspectiveOption struct {
+	Threshold      uint8   // min brightness of the page (0~255). darker dots are the desk
+	AutoThreshold  bool    // selects Threshold of each page by Otsu's method ("threshold: auto")
+	LockThreshold  bool    // uses one auto threshold for the book
+	AspectRatio    float32 // height / width of the output. estimated from the page edges if 0
+	MinAreaRate    float32 // min area of the page as rate of the image (default: 0.2)
+	MinConfidence  float32 // pages are corrected only if confidence >= value (0~1, default: 0.9)
+	EdgeTrimRate   float32 // rate of each edge near the corners excluded from line fitting (default: 0.1)
+	DebugOutputDir string  // writes annotated images if not empty
+}
+
+func NewPerspectiveOption(m map[string]interface{}) (*PerspectiveOption, error) {
+	option := PerspectiveOption{}
+
+	m, auto := parseAutoThreshold(m)
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+	option.AutoThreshold = option.AutoThreshold || auto
+
+	if option.AspectRatio < 0 {
+		return nil, fmt.Errorf("invalid aspectRatio : %v", option.AspectRatio)
+	}
+	if option.MinAreaRate < 0 || option.MinAreaRate > 1 ||
+		option.MinConfidence < 0 || option.MinConfidence > 1 {
+		return nil, fmt.Errorf("invalid minAreaRate or minConfidence : minAreaRate=%v, minConfidence=%v",
+			option.MinAreaRate, option.MinConfidence)
+	}
+	if option.EdgeTrimRate < 0 || option.EdgeTrimRate >= 0.5 {
+		return nil, fmt.Errorf("invalid edgeTrimRate : %v", option.EdgeTrimRate)
+	}
+
+	return &option, nil
+}
+
+type PerspectiveResult struct {
+	thresholdResult
+	image      image.Image
+	quad       quad
+	confidence float32
+	corrected  bool
+}
+
+func (r PerspectiveResult) Img() image.Image {
+	return r.image
+}
+
+func (r PerspectiveResult) Log() {
+	r.logThreshold()
+	if r.corrected {
+		log.Printf("[PERSPECTIVE] %v : %v (confidence %.2f)\n", r.filename, r.quad, r.confidence)
+	}
+}
+
+func (r PerspectiveResult) Report(report *PageReport) {
+	r.reportThreshold(report)
+}
+
+// ----------------------------------------------------------------------------
+
+// PerspectiveFilter finds the quadrilateral of a photographed page on a darker desk
+// and maps it to a rectangle with a homography.
+type PerspectiveFilter struct {
+	autoThresholdFilter
+	option PerspectiveOption
+}
+
+func NewPerspectiveFilter(option PerspectiveOption) *PerspectiveFilter {
+	if option.MinAreaRate == 0 {
+		option.MinAreaRate = defaultPerspectiveMinAreaRate
+	}
+	if option.MinConfidence == 0 {
+		option.MinConfidence = defaultPerspectiveMinConfidence
+	}
+	if option.EdgeTrimRate == 0 {
+		option.EdgeTrimRate = defaultPerspectiveEdgeTrimRate
+	}
+
+	return &PerspectiveFilter{
+		option:              option,
+		autoThresholdFilter: autoThresholdFilter{newAutoThreshold(option.AutoThreshold, option.LockThreshold)},
+	}
+}
+
+func init() {
+	RegisterFilter("perspective", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewPerspectiveOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewPerspectiveFilter(*option), nil
+	})
+}
+
+// Implements Filter.Run()
+func (f PerspectiveFilter) Run(s *FilterSource) (FilterResult, error) {
+	f.option.DebugOutputDir = s.debugOutputDir(f.option.DebugOutputDir)
+	if f.threshold.enabled() {
+		f.option.Threshold = f.threshold.get(s.image)
+	}
+	threshold := thresholdResult{s.filename, f.threshold.enabled(), f.option.Threshold}
+
+	q, confidence, found := f.findQuad(s.image)
+	if f.option.DebugOutputDir != "" {
+		f.saveDebugImage(s.image, s.filename, q, confidence, found)
+	}
+	if !found || confidence < f.option.MinConfidence || q.isImage(s.image.Bounds()) {
+		return PerspectiveResult{threshold, s.image, q, confidence, false}, nil
+	}
+
+	width, height := q.size()
+	if f.option.AspectRatio > 0 {
+		height = int(float64(width)*float64(f.option.AspectRatio) + 0.5)
+	}
+	dest, ok := warpPerspective(s.image, q, width, height)
+	if !ok {
+		return PerspectiveResult{threshold, s.image, q, confidence, false}, nil
+	}
+	return PerspectiveResult{threshold, dest, q, confidence, true}, nil
+}
+
+// point is a point with sub-pixel precision.
+type point struct {
+	x, y float64
+}
+
+// quad is a quadrilateral of top left, top right, bottom right and bottom left corners.
+type quad [4]point
+
+func (q quad) String() string {
+	return fmt.Sprintf("(%.0f,%.0f) (%.0f,%.0f) (%.0f,%.0f) (%.0f,%.0f)",
+		q[0].x, q[0].y, q[1].x, q[1].y, q[2].x, q[2].y, q[3].x, q[3].y)
+}
+
+// size returns the average lengths of the top/bottom and the left/right edges.
+func (q quad) size() (int, int) {
+	distance := func(a, b point) float64 { return math.Hypot(b.x-a.x, b.y-a.y) }
+	width := (distance(q[0], q[1]) + distance(q[3], q[2])) / 2
+	height := (distance(q[0], q[3]) + distance(q[1], q[2])) / 2
+	return int(width + 0.5), int(height + 0.5)
+}
+
+// area returns the area by the shoelace formula. It is negative if the quad is not clockwise.
+func (q quad) area() float64 {
+	sum := 0.0
+	for i := range q {
+		j := (i + 1) % len(q)
+		sum += q[i].x*q[j].y - q[j].x*q[i].y
+	}
+	return sum / 2
+}
+
+// isImage checks whether all corners are within 1% of the image corners.
+func (q quad) isImage(bounds image.Rectangle) bool {
+	width, height := float64(bounds.Dx()), float64(bounds.Dy())
+	corners := quad{{0, 0}, {width, 0}, {width, height}, {0, height}}
+	for i := range q {
+		if math.Abs(q[i].x-corners[i].x) > width/100 || math.Abs(q[i].y-corners[i].y) > height/100 {
+			return false
+		}
+	}
+	return true
+}
+
+// findQuad returns the quadrilateral of the largest connected area of page dots
+// and its confidence, which is how well the quad covers the area (0~1).
+// Corners are the intersections of lines fitted to the edges of the area.
+func (f PerspectiveFilter) findQuad(src image.Image) (quad, float32, bool) {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 2 || height < 2 {
+		return quad{}, 0, false
+	}
+
+	// 4-connected components of page dots
+	thresholdSum := uint32(f.option.Threshold) * 256 * 3
+	light := make([]bool, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if r, g, b, _ := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA(); r+g+b >= thresholdSum {
+				light[y*width+x] = true
+			}
+		}
+	}
+	labels := make([]int32, width*height)
+	largest, largestCount := int32(0), 0
+	var stack []int
+	label := int32(0)
+	for start, isLight := range light {
+		if !isLight || labels[start] != 0 {
+			continue
+		}
+		label++
+		count := 0
+		labels[start] = label
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			count++
+			x := i % width
+			for _, n := range [4]int{i - 1, i + 1, i - width, i + width} {
+				if (n == i-1 && x == 0) || (n == i+1 && x == width-1) || n < 0 || n >= len(light) {
+					continue
+				}
+				if light[n] && labels[n] == 0 {
+					labels[n] = label
+					stack = append(stack, n)
+				}
+			}
+		}
+		if count > largestCount {
+			largest, largestCount = label, count
+		}
+	}
+	if largestCount == 0 {
+		return quad{}, 0, false
+	}
+
+	// outline of the component. holes such as text are filled by the spans.
+	left, right := make([]int, height), make([]int, height)
+	top, bottom := make([]int, width), make([]int, width)
+	for i := range left {
+		left[i], right[i] = -1, -1
+	}
+	for i := range top {
+		top[i], bottom[i] = -1, -1
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if labels[y*width+x] != largest {
+				continue
+			}
+			if left[y] < 0 {
+				left[y] = x
+			}
+			right[y] = x
+			if top[x] < 0 {
+				top[x] = y
+			}
+			bottom[x] = y
+		}
+	}
+	area := 0
+	for y := 0; y < height; y++ {
+		if left[y] >= 0 {
+			area += right[y] - left[y] + 1
+		}
+	}
+	if float32(area) < float32(width*height)*f.option.MinAreaRate {
+		return quad{}, 0, false
+	}
+
+	// rough corners by extremes of x+y and x-y
+	var rough [4]point
+	minSum, maxDiff, maxSum, minDiff := math.MaxInt32, math.MinInt32, math.MinInt32, math.MaxInt32
+	for y := 0; y < height; y++ {
+		if left[y] < 0 {
+			continue
+		}
+		for _, x := range []int{left[y], right[y]} {
+			if x+y < minSum {
+				minSum, rough[0] = x+y, point{float64(x), float64(y)}
+			}
+			if x-y > maxDiff {
+				maxDiff, rough[1] = x-y, point{float64(x), float64(y)}
+			}
+			if x+y > maxSum {
+				maxSum, rough[2] = x+y, point{float64(x), float64(y)}
+			}
+			if x-y < minDiff {
+				minDiff, rough[3] = x-y, point{float64(x), float64(y)}
+			}
+		}
+	}
+
+	// lines of edges : top/bottom y = a*x + b, left/right x = a*y + b
+	trim := float64(f.option.EdgeTrimRate)
+	topLine, ok1 := fitEdge(top, rough[0].x, rough[1].x, trim, 0)
+	bottomLine, ok2 := fitEdge(bottom, rough[3].x, rough[2].x, trim, 1)
+	leftLine, ok3 := fitEdge(left, rough[0].y, rough[3].y, trim, 0)
+	rightLine, ok4 := fitEdge(right, rough[1].y, rough[2].y, trim, 1)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return quad{}, 0, false
+	}
+
+	var q quad
+	for i, lines := range [4][2][]float64{
+		{topLine, leftLine}, {topLine, rightLine}, {bottomLine, rightLine}, {bottomLine, leftLine},
+	} {
+		horizontal, vertical := lines[0], lines[1]
+		denominator := 1 - vertical[1]*horizontal[1]
+		if math.Abs(denominator) < 1e-9 {
+			return quad{}, 0, false
+		}
+		x := (vertical[1]*horizontal[0] + vertical[0]) / denominator
+		q[i] = point{x, horizontal[0] + horizontal[1]*x}
+	}
+
+	quadArea := q.area()
+	if quadArea <= 0 {
+		return q, 0, true
+	}
+	confidence := 1 - math.Abs(quadArea-float64(area))/quadArea
+	return q, float32(math.Max(0, confidence)), true
+}
+
+// fitEdge fits a line to the outline values between from and to, excluding
+// trim rate at both ends. offset is added to the values, 1 for bottom and right
+// outlines to get the outer edge of the dots.
+// It returns coefficients of value = c[0] + c[1] * index.
+func fitEdge(outline []int, from, to, trim float64, offset int) ([]float64, bool) {
+	length := to - from
+	start, end := int(from+length*trim), int(to-length*trim)
+	var xs, ys []float64
+	for i := Max(0, start); i <= end && i < len(outline); i++ {
+		if outline[i] >= 0 {
+			xs = append(xs, float64(i))
+			ys = append(ys, float64(outline[i]+offset))
+		}
+	}
+	return fitPolynomial(xs, ys, 1)
+}
+
+// warpPerspective maps the quad of the source image to a width x height image
+// by the homography between them with bilinear interpolation.
+// Dots out of the source are white. *image.Gray images stay *image.Gray.
+func warpPerspective(src image.Image, q quad, width, height int) (image.Image, bool) {
+	if width <= 0 || height <= 0 {
+		return nil, false
+	}
+
+	// homography from the output rectangle to the source quad
+	corners := quad{{0, 0}, {float64(width), 0}, {float64(width), float64(height)}, {0, float64(height)}}
+	matrix := make([][]float64, 0, 8)
+	for i := range corners {
+		x, y, u, v := corners[i].x, corners[i].y, q[i].x, q[i].y
+		matrix = append(matrix,
+			[]float64{x, y, 1, 0, 0, 0, -u * x, -u * y, u},
+			[]float64{0, 0, 0, x, y, 1, -v * x, -v * y, v})
+	}
+	h, ok := solveLinear(matrix)
+	if !ok {
+		return nil, false
+	}
+
+	bounds := src.Bounds()
+	gray, isGray := src.(*image.Gray)
+	var destGray *image.Gray
+	var destRGBA *image.RGBA
+	if isGray {
+		destGray = image.NewGray(image.Rect(0, 0, width, height))
+	} else {
+		destRGBA = image.NewRGBA(image.Rect(0, 0, width, height))
+	}
+
+	at := func(x, y int) [4]float64 {
+		if x < 0 || y < 0 || x >= bounds.Dx() || y >= bounds.Dy() {
+			return [4]float64{255, 255, 255, 255}
+		}
+		if isGray {
+			v := float64(gray.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y)
+			return [4]float64{v, v, v, 255}
+		}
+		r, g, b, a := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+		return [4]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8), float64(a >> 8)}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// centre of the output dot
+			dx, dy := float64(x)+0.5, float64(y)+0.5
+			w := h[6]*dx + h[7]*dy + 1
+			sx := (h[0]*dx+h[1]*dy+h[2])/w - 0.5
+			sy := (h[3]*dx+h[4]*dy+h[5])/w - 0.5
+
+			x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+			tx, ty := sx-float64(x0), sy-float64(y0)
+			c00, c10, c01, c11 := at(x0, y0), at(x0+1, y0), at(x0, y0+1), at(x0+1, y0+1)
+			var c [4]uint8
+			for i := range c {
+				top := c00[i]*(1-tx) + c10[i]*tx
+				bottom := c01[i]*(1-tx) + c11[i]*tx
+				c[i] = uint8(top*(1-ty) + bottom*ty + 0.5)
+			}
+			if isGray {
+				destGray.Pix[y*destGray.Stride+x] = c[0]
+			} else {
+				destRGBA.SetRGBA(x, y, color.RGBA{c[0], c[1], c[2], c[3]})
+			}
+		}
+	}
+
+	if isGray {
+		return destGray, true
+	}
+	return destRGBA, true
+}
+
+// saveDebugImage writes the image with the detected quad.
+func (f PerspectiveFilter) saveDebugImage(src image.Image, filename string, q quad, confidence float32, found bool) {
+	img := newDebugImage(src)
+	if found {
+		for i := range q {
+			a, b := q[i], q[(i+1)%len(q)]
+			steps := int(math.Max(math.Abs(b.x-a.x), math.Abs(b.y-a.y))) + 1
+			for s := 0; s <= steps; s++ {
+				t := float64(s) / float64(steps)
+				x, y := int(a.x+(b.x-a.x)*t), int(a.y+(b.y-a.y)*t)
+				FillRect(img, x-1, y-1, x+2, y+2, debugCropColor)
+			}
+		}
+	}
+	drawDebugLabels(img, []string{
+		fmt.Sprintf("quad       : %v", q),
+		fmt.Sprintf("confidence : %.2f", confidence),
+	})
+	saveDebugImage(img, f.option.DebugOutputDir, filename, "perspective")
+}
@@ -0,0 +1,102 @@
+package lecimg
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+var perspectiveTestQuad = quad{{60, 40}, {330, 70}, {350, 360}, {40, 340}}
+
+// createPhotoPage draws a white quad with a dark text block on a dark desk.
+func createPhotoPage(q quad) *image.RGBA {
+	img := CreateImage(400, 400, color.Gray{40})
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 400; x++ {
+			inside := true
+			for i := range q {
+				a, b := q[i], q[(i+1)%len(q)]
+				px, py := float64(x)+0.5, float64(y)+0.5
+				if (b.x-a.x)*(py-a.y)-(b.y-a.y)*(px-a.x) < 0 {
+					inside = false
+					break
+				}
+			}
+			if inside {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+	FillRect(img, 150, 150, 250, 250, color.Black)
+	return img
+}
+
+func TestPerspective(t *testing.T) {
+	result := runTestFilter(t, NewPerspectiveFilter(PerspectiveOption{Threshold: 128}), createPhotoPage(perspectiveTestQuad)).(PerspectiveResult)
+	if !result.corrected {
+		t.Fatalf("page should be corrected. quad=%v, confidence=%v", result.quad, result.confidence)
+	}
+	for i, corner := range perspectiveTestQuad {
+		if math.Abs(result.quad[i].x-corner.x) > 2 || math.Abs(result.quad[i].y-corner.y) > 2 {
+			t.Errorf("corner %v mismatch. expected=%v, actual=%v", i, corner, result.quad[i])
+		}
+	}
+
+	bounds := result.Img().Bounds()
+	width, height := perspectiveTestQuad.size()
+	if bounds.Dx() != width || bounds.Dy() != height {
+		t.Errorf("size mismatch. expected=%vx%v, actual=%v", width, height, bounds)
+	}
+	for _, p := range []image.Point{{1, 1}, {width - 2, 1}, {width - 2, height - 2}, {1, height - 2}} {
+		if isDark(result.Img(), p.X, p.Y) {
+			t.Errorf("desk should not remain at the corner %v", p)
+		}
+	}
+	if !isDark(result.Img(), width/2, height/2) {
+		t.Errorf("text should be kept")
+	}
+}
+
+func TestPerspectiveAspectRatio(t *testing.T) {
+	result := runTestFilter(t, NewPerspectiveFilter(PerspectiveOption{Threshold: 128, AspectRatio: 1.5}), createPhotoPage(perspectiveTestQuad)).(PerspectiveResult)
+	bounds := result.Img().Bounds()
+	if math.Abs(float64(bounds.Dy())-float64(bounds.Dx())*1.5) > 1 {
+		t.Errorf("aspect ratio mismatch. actual=%v", bounds)
+	}
+}
+
+func TestPerspectivePassThrough(t *testing.T) {
+	// a round object is not a page
+	img := CreateImage(400, 400, color.Gray{40})
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 400; x++ {
+			if (x-200)*(x-200)+(y-200)*(y-200) < 150*150 {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+	if result := runTestFilter(t, NewPerspectiveFilter(PerspectiveOption{Threshold: 128}), img).(PerspectiveResult); result.corrected || result.Img() != img {
+		t.Errorf("page with low confidence should be left alone. confidence=%v", result.confidence)
+	}
+
+	// the page fills the image
+	scan := createPhotoPage(quad{{0, 0}, {400, 0}, {400, 400}, {0, 400}})
+	if result := runTestFilter(t, NewPerspectiveFilter(PerspectiveOption{Threshold: 128}), scan).(PerspectiveResult); result.corrected {
+		t.Errorf("page without desk should be left alone. quad=%v", result.quad)
+	}
+
+	// too small page
+	small := createPhotoPage(quad{{10, 10}, {60, 10}, {60, 60}, {10, 60}})
+	if result := runTestFilter(t, NewPerspectiveFilter(PerspectiveOption{Threshold: 128}), small).(PerspectiveResult); result.corrected {
+		t.Errorf("small page should be left alone")
+	}
+}
+
+func TestPerspectiveGray(t *testing.T) {
+	gray := grayImage(createPhotoPage(perspectiveTestQuad))
+	result := runTestFilter(t, NewPerspectiveFilter(PerspectiveOption{Threshold: 128}), gray).(PerspectiveResult)
+	if _, ok := result.Img().(*image.Gray); !ok || !result.corrected {
+		t.Errorf("gray page should stay gray. actual=%T", result.Img())
+	}
+}
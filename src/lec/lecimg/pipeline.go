@@ -0,0 +1,526 @@
+package lecimg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"lec/lecio"
+)
+
+// ErrorPolicy defines how a page is handled when a filter fails.
+type ErrorPolicy int
+
+const (
+	// PassThroughOnError keeps the original page unchanged.
+	PassThroughOnError ErrorPolicy = iota
+	// SkipOnError drops the page from the output.
+	SkipOnError
+	// AbortOnError stops processing the book.
+	AbortOnError
+)
+
+var errorPolicyNames = map[ErrorPolicy]string{
+	PassThroughOnError: "passThrough",
+	SkipOnError:        "skip",
+	AbortOnError:       "abort",
+}
+
+// ParseErrorPolicy returns ErrorPolicy of given name.
+// Empty name returns PassThroughOnError.
+func ParseErrorPolicy(name string) (ErrorPolicy, error) {
+	if name == "" {
+		return PassThroughOnError, nil
+	}
+	for policy, policyName := range errorPolicyNames {
+		if policyName == name {
+			return policy, nil
+		}
+	}
+	return PassThroughOnError, fmt.Errorf("unknown error policy : %v", name)
+}
+
+func (p ErrorPolicy) String() string {
+	return errorPolicyNames[p]
+}
+
+// ----------------------------------------------------------------------------
+
+// PageError is an error occurred while processing a page.
+type PageError struct {
+	Filename   string
+	Index      int
+	FilterName string
+	Err        error
+}
+
+func (e PageError) Error() string {
+	if e.FilterName == "" {
+		return fmt.Sprintf("%v : %v", e.Filename, e.Err)
+	}
+	return fmt.Sprintf("%v : %v : %v", e.Filename, e.FilterName, e.Err)
+}
+
+type pageErrors []PageError
+
+func (e pageErrors) Len() int {
+	return len(e)
+}
+
+func (e pageErrors) Less(i, j int) bool {
+	if e[i].Index != e[j].Index {
+		return e[i].Index < e[j].Index
+	}
+	return e[i].Filename < e[j].Filename
+}
+
+func (e pageErrors) Swap(i, j int) {
+	e[i], e[j] = e[j], e[i]
+}
+
+// DroppedPage is a page removed from the output by a filter.
+type DroppedPage struct {
+	Filename   string
+	Index      int
+	FilterName string
+}
+
+func (d DroppedPage) String() string {
+	return fmt.Sprintf("%v : %v", d.Filename, d.FilterName)
+}
+
+type droppedPages []DroppedPage
+
+func (d droppedPages) Len() int {
+	return len(d)
+}
+
+func (d droppedPages) Less(i, j int) bool {
+	if d[i].Index != d[j].Index {
+		return d[i].Index < d[j].Index
+	}
+	return d[i].Filename < d[j].Filename
+}
+
+func (d droppedPages) Swap(i, j int) {
+	d[i], d[j] = d[j], d[i]
+}
+
+// RunSummary collects pages failed or dropped during a run.
+// It is safe for concurrent use.
+type RunSummary struct {
+	mutex    sync.Mutex
+	failures pageErrors
+	dropped  droppedPages
+}
+
+// AddFailure adds a failed page.
+func (s *RunSummary) AddFailure(err PageError) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures = append(s.failures, err)
+}
+
+// Failures returns failed pages sorted by page index.
+func (s *RunSummary) Failures() []PageError {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	failures := make(pageErrors, len(s.failures))
+	copy(failures, s.failures)
+	sort.Sort(failures)
+	return failures
+}
+
+// AddDropped adds a dropped page.
+func (s *RunSummary) AddDropped(page DroppedPage) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.dropped = append(s.dropped, page)
+}
+
+// Dropped returns dropped pages sorted by page index.
+func (s *RunSummary) Dropped() []DroppedPage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	dropped := make(droppedPages, len(s.dropped))
+	copy(dropped, s.dropped)
+	sort.Sort(dropped)
+	return dropped
+}
+
+// Log prints failed and dropped pages.
+func (s *RunSummary) Log() {
+	if failures := s.Failures(); len(failures) > 0 {
+		log.Printf("[SUMMARY] failed pages : %v\n", len(failures))
+		for _, failure := range failures {
+			log.Printf("  %v\n", failure)
+		}
+	}
+	if dropped := s.Dropped(); len(dropped) > 0 {
+		log.Printf("[SUMMARY] dropped pages : %v\n", len(dropped))
+		for _, page := range dropped {
+			log.Printf("  %v\n", page)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+type pipelineStage struct {
+	name     string
+	filter   Filter
+	selector *PageSelector
+}
+
+// Pipeline runs filters in order and handles filter errors by ErrorPolicy.
+// It is safe for concurrent use.
+type Pipeline struct {
+	stages       []pipelineStage
+	errorPolicy  ErrorPolicy
+	deviceWidth  int
+	deviceHeight int
+	fitDevice    bool
+	pageCount    int
+	pageQuality  int
+	analysisPass int // index of the current analysis pass
+	summary      RunSummary
+	report       Report
+	aborted      int32
+}
+
+// NewPipeline creates an instance of Pipeline
+func NewPipeline(errorPolicy ErrorPolicy) *Pipeline {
+	return &Pipeline{errorPolicy: errorPolicy}
+}
+
+// AddFilter appends a filter to the pipeline.
+// The filter is applied only to the pages matched by selector.
+// nil selector selects all pages.
+func (p *Pipeline) AddFilter(name string, filter Filter, selector *PageSelector) {
+	p.stages = append(p.stages, pipelineStage{
+		name:     name,
+		filter:   filter,
+		selector: selector,
+	})
+}
+
+// SetPageCount sets the number of pages in the book.
+// It should be called before Run. 0 means unknown page count.
+func (p *Pipeline) SetPageCount(count int) {
+	p.pageCount = count
+}
+
+// SetDeviceSize makes the pipeline resize result images to fit the device
+// while preserving aspect ratio. Filters also get the device size from FilterSource.
+func (p *Pipeline) SetDeviceSize(width, height int) {
+	p.deviceWidth, p.deviceHeight = width, height
+	p.fitDevice = true
+}
+
+// SetPageQuality sets the jpeg quality of page files which filters write,
+// e.g. blank pages moved by removeBlank.
+func (p *Pipeline) SetPageQuality(quality int) {
+	p.pageQuality = quality
+}
+
+// Summary returns the summary of the run.
+func (p *Pipeline) Summary() *RunSummary {
+	return &p.summary
+}
+
+// Report returns the reports of processed pages.
+func (p *Pipeline) Report() *Report {
+	return &p.report
+}
+
+// Aborted returns true if the pipeline is aborted by AbortOnError policy.
+func (p *Pipeline) Aborted() bool {
+	return atomic.LoadInt32(&p.aborted) != 0
+}
+
+// Fail records a failed page.
+// It returns the error if the book should be aborted.
+func (p *Pipeline) Fail(err PageError) error {
+	log.Printf("[FAIL] %v\n", err)
+	p.summary.AddFailure(err)
+
+	if p.errorPolicy == AbortOnError {
+		atomic.StoreInt32(&p.aborted, 1)
+		return err
+	}
+	return nil
+}
+
+// Run applies filters to the image and returns the first output page.
+// Returned image is nil if the page should be skipped.
+// Returned error is not nil only if the book should be aborted.
+func (p *Pipeline) Run(src image.Image, filename string, index int) (image.Image, error) {
+	pages, err := p.RunPages(src, filename, index)
+	if len(pages) == 0 {
+		return nil, err
+	}
+	return pages[0], err
+}
+
+// RunPages applies filters to the image and returns output pages in order.
+// A filter may split a page into several pages, then following filters
+// are applied to each of them.
+// Returned slice is empty if the page should be skipped or filters dropped it.
+// Returned error is not nil only if the book should be aborted.
+func (p *Pipeline) RunPages(src image.Image, filename string, index int) ([]image.Image, error) {
+	startTime := time.Now()
+	report := newPageReport(src, filename, index)
+
+	pages, err := p.run(src, filename, index, report)
+
+	report.setOutput(pages, startTime)
+	p.report.Add(report)
+	return pages, err
+}
+
+func (p *Pipeline) run(src image.Image, filename string, index int, report *PageReport) ([]image.Image, error) {
+	pages := []sourcePage{{image: src, filename: filename}}
+
+stages:
+	for _, stage := range p.stages {
+		var dest []image.Image
+		matched := false
+		for _, page := range pages {
+			if !stage.selector.matchPage(filename, index, page.parityIndex(index), p.pageCount) {
+				dest = append(dest, page.image)
+				continue
+			}
+			matched = true
+
+			result, err := runFilter(stage.filter, p.newFilterSource(stage.filter, page, index))
+			if err != nil {
+				pageErr := PageError{
+					Filename:   filename,
+					Index:      index,
+					FilterName: stage.name,
+					Err:        err,
+				}
+				// facts of the stages before are discarded with their output
+				*report = *newPageReport(src, filename, index)
+				report.Error = pageErr.Error()
+
+				abortErr := p.Fail(pageErr)
+				if abortErr != nil || p.errorPolicy == SkipOnError {
+					return nil, abortErr
+				}
+				pages = []sourcePage{{image: src, filename: filename}}
+				break stages
+			}
+
+			result.Log()
+			if reportable, ok := result.(ReportableResult); ok {
+				reportable.Report(report)
+			}
+			images := resultImages(result)
+			if len(images) == 0 {
+				p.summary.AddDropped(DroppedPage{Filename: page.filename, Index: index, FilterName: stage.name})
+			}
+			dest = append(dest, images...)
+		}
+		if !matched {
+			continue
+		}
+		report.Filters = append(report.Filters, stage.name)
+		pages = splitPages(dest, filename)
+	}
+
+	images := make([]image.Image, len(pages))
+	for i, page := range pages {
+		images[i] = page.image
+		if p.fitDevice {
+			images[i] = FitImage(page.image, p.deviceWidth, p.deviceHeight)
+		}
+	}
+	return images, nil
+}
+
+// sourcePage is a page processed from a source page.
+// Pages split from the source page have their own sub-index and filename
+// so that following filters handle them as separate pages.
+type sourcePage struct {
+	image    image.Image
+	filename string
+	subIndex int
+	subCount int
+}
+
+// parityIndex returns the index whose parity makes even and odd pages
+// like FilterSource.parityIndex().
+func (page sourcePage) parityIndex(index int) int {
+	if page.subCount > 1 {
+		return page.subIndex
+	}
+	return index
+}
+
+// splitPages returns the pages of a source page in order.
+// Pages are named like the output pages, e.g. "p01-002.jpg".
+func splitPages(images []image.Image, filename string) []sourcePage {
+	pages := make([]sourcePage, len(images))
+	for i, img := range images {
+		pages[i] = sourcePage{
+			image:    img,
+			filename: lecio.GetPageFilename(filename, i, len(images)),
+			subIndex: i,
+			subCount: len(images),
+		}
+	}
+	return pages
+}
+
+// needsDeviceSize returns true if the filter works on pages of the device size.
+func needsDeviceSize(filter Filter) bool {
+	deviceFilter, ok := filter.(DeviceFilter)
+	return ok && deviceFilter.NeedsDeviceSize()
+}
+
+// newFilterSource creates the source of the filter for a page.
+// The page is fitted to the device first if the filter needs the device size.
+func (p *Pipeline) newFilterSource(filter Filter, page sourcePage, index int) *FilterSource {
+	img := page.image
+	if p.fitDevice && needsDeviceSize(filter) {
+		img = FitImage(img, p.deviceWidth, p.deviceHeight)
+	}
+	s := NewFilterSource(img, page.filename, index)
+	s.subIndex, s.subCount = page.subIndex, page.subCount
+	s.pageCount = p.pageCount
+	s.pageQuality = p.pageQuality
+	if p.fitDevice {
+		s.deviceWidth, s.deviceHeight = p.deviceWidth, p.deviceHeight
+	}
+	return s
+}
+
+// NeedsAnalysis returns true if any filter should analyze every page
+// before processing. It turns false after the last analysis pass,
+// so the analysis pass is repeated while it returns true.
+func (p *Pipeline) NeedsAnalysis() bool {
+	return p.lastAnalysisStage() >= 0
+}
+
+func (p *Pipeline) lastAnalysisStage() int {
+	last := -1
+	for i, stage := range p.stages {
+		if p.analyzes(stage.filter) != nil {
+			last = i
+		}
+	}
+	return last
+}
+
+// analyzes returns the filter as BookFilter if it analyzes pages in the current pass.
+func (p *Pipeline) analyzes(filter Filter) BookFilter {
+	bookFilter, ok := filter.(BookFilter)
+	if !ok || !bookFilter.NeedsAnalysis() {
+		return nil
+	}
+	passes := 1
+	if multiPass, ok := filter.(MultiPassFilter); ok {
+		passes = multiPass.AnalysisPasses()
+	}
+	if p.analysisPass >= passes {
+		return nil
+	}
+	return bookFilter
+}
+
+// Analyze runs the analysis pass for a page.
+// Filters before a BookFilter are applied to the page to get the image
+// to analyze. BookFilters analyze the page first, then they are applied
+// with per-page values if a later BookFilter needs the result.
+// Errors are logged only, they are reported by Run.
+func (p *Pipeline) Analyze(src image.Image, filename string, index int) {
+	last := p.lastAnalysisStage()
+	pages := []sourcePage{{image: src, filename: filename}}
+	for i := 0; i <= last; i++ {
+		stage := p.stages[i]
+
+		var dest []image.Image
+		for _, page := range pages {
+			if !stage.selector.matchPage(filename, index, page.parityIndex(index), p.pageCount) {
+				dest = append(dest, page.image)
+				continue
+			}
+
+			s := p.newFilterSource(stage.filter, page, index)
+			s.analysis = true
+			if bookFilter := p.analyzes(stage.filter); bookFilter != nil {
+				if err := analyzePage(bookFilter, s); err != nil {
+					log.Printf("[ANALYZE] %v : %v : %v\n", page.filename, stage.name, err)
+				}
+				if i == last {
+					continue
+				}
+			}
+
+			result, err := runFilter(stage.filter, s)
+			if err != nil {
+				log.Printf("[ANALYZE] %v : %v : %v\n", page.filename, stage.name, err)
+				return
+			}
+			dest = append(dest, resultImages(result)...)
+		}
+		pages = splitPages(dest, filename)
+	}
+}
+
+// EndAnalysis finishes the analysis pass.
+// It should be called after all pages are analyzed and before Run
+// or the next analysis pass.
+func (p *Pipeline) EndAnalysis() {
+	for _, stage := range p.stages {
+		if bookFilter := p.analyzes(stage.filter); bookFilter != nil {
+			bookFilter.EndAnalysis()
+		}
+	}
+	p.analysisPass++
+}
+
+// analyzePage runs BookFilter.Analyze and converts a panic to an error.
+func analyzePage(filter BookFilter, s *FilterSource) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic : %v", r)
+		}
+	}()
+	return filter.Analyze(s)
+}
+
+// runFilter runs a filter and converts a panic to an error.
+func runFilter(filter Filter, s *FilterSource) (result FilterResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("panic : %v", r)
+		}
+	}()
+
+	result, err = filter.Run(s)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, errors.New("filter result is nil")
+	}
+	if _, ok := result.(MultiPageResult); !ok && result.Img() == nil {
+		return nil, errors.New("filter result is nil")
+	}
+	for _, img := range resultImages(result) {
+		if img == nil {
+			return nil, errors.New("filter result is nil")
+		}
+		if img.Bounds().Empty() {
+			return nil, errors.New("filter result is empty")
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,136 @@
+package lecimg
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+type failingFilter struct {
+	failIndex int
+}
+
+type failingResult struct {
+	image image.Image
+}
+
+func (r failingResult) Img() image.Image {
+	return r.image
+}
+
+func (r failingResult) Log() {
+}
+
+func (f failingFilter) Run(s *FilterSource) (FilterResult, error) {
+	if s.index == f.failIndex {
+		return nil, errors.New("failed")
+	}
+	return failingResult{CreateImage(10, 10, color.Black)}, nil
+}
+
+// recordingFilter records the sources and returns them unchanged.
+type recordingFilter struct {
+	sources *[]FilterSource
+}
+
+func (f recordingFilter) Run(s *FilterSource) (FilterResult, error) {
+	*f.sources = append(*f.sources, *s)
+	return failingResult{s.image}, nil
+}
+
+type panicFilter struct {
+}
+
+func (f panicFilter) Run(s *FilterSource) (FilterResult, error) {
+	panic("panic filter")
+}
+
+func testPipelinePolicy(t *testing.T, policy ErrorPolicy, index int, expectedImg image.Image, expectAbort bool) {
+	src := CreateImage(20, 20, color.White)
+
+	pipeline := NewPipeline(policy)
+	pipeline.AddFilter("fail", failingFilter{failIndex: 1}, nil)
+
+	dest, err := pipeline.Run(src, "filename", index)
+	if (err != nil) != expectAbort || pipeline.Aborted() != expectAbort {
+		t.Errorf("abort mismatch. expected=%v, actual=%v", expectAbort, err)
+	}
+
+	if expectedImg == nil {
+		if dest != nil {
+			t.Errorf("nil image expected")
+		}
+	} else if dest == nil || dest.Bounds() != expectedImg.Bounds() {
+		t.Errorf("image mismatch. expected=%v", expectedImg.Bounds())
+	}
+}
+
+func TestPipelineSuccess(t *testing.T) {
+	testPipelinePolicy(t, AbortOnError, 0, image.NewRGBA(image.Rect(0, 0, 10, 10)), false)
+}
+
+func TestPipelinePassThrough(t *testing.T) {
+	testPipelinePolicy(t, PassThroughOnError, 1, image.NewRGBA(image.Rect(0, 0, 20, 20)), false)
+}
+
+func TestPipelineSkip(t *testing.T) {
+	testPipelinePolicy(t, SkipOnError, 1, nil, false)
+}
+
+func TestPipelineAbort(t *testing.T) {
+	testPipelinePolicy(t, AbortOnError, 1, nil, true)
+}
+
+func TestPipelinePanic(t *testing.T) {
+	pipeline := NewPipeline(SkipOnError)
+	pipeline.AddFilter("panic", panicFilter{}, nil)
+
+	dest, err := pipeline.Run(CreateImage(20, 20, color.White), "filename", 3)
+	if dest != nil || err != nil {
+		t.Errorf("page should be skipped")
+	}
+
+	failures := pipeline.Summary().Failures()
+	if len(failures) != 1 {
+		t.Fatalf("failure count mismatch. expected=1, actual=%v", len(failures))
+	}
+	if failures[0].Index != 3 || failures[0].FilterName != "panic" {
+		t.Errorf("failure mismatch. actual=%v", failures[0])
+	}
+}
+
+func TestParseErrorPolicy(t *testing.T) {
+	for name, expected := range map[string]ErrorPolicy{
+		"":            PassThroughOnError,
+		"passThrough": PassThroughOnError,
+		"skip":        SkipOnError,
+		"abort":       AbortOnError,
+	} {
+		if policy, err := ParseErrorPolicy(name); err != nil || policy != expected {
+			t.Errorf("policy mismatch. name=%v, expected=%v, actual=%v", name, expected, policy)
+		}
+	}
+
+	if _, err := ParseErrorPolicy("ignore"); err == nil {
+		t.Errorf("error expected for unknown policy")
+	}
+}
+
+func TestPipelineSelector(t *testing.T) {
+	selector, _ := NewPageSelector("!0,!-1")
+
+	pipeline := NewPipeline(AbortOnError)
+	pipeline.AddFilter("fail", failingFilter{failIndex: -1}, selector)
+	pipeline.SetPageCount(3)
+
+	for index, expectedWidth := range []int{20, 10, 20} {
+		dest, err := pipeline.Run(CreateImage(20, 20, color.White), "filename", index)
+		if err != nil {
+			t.Fatalf("pipeline failed : %v", err)
+		}
+		if dest.Bounds().Dx() != expectedWidth {
+			t.Errorf("width mismatch. index=%v, expected=%v, actual=%v", index, expectedWidth, dest.Bounds().Dx())
+		}
+	}
+}
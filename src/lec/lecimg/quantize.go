@@ -0,0 +1,239 @@
+package lecimg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// dithering methods
+const (
+	DitherNone           = "none"
+	DitherFloydSteinberg = "floydSteinberg"
+	DitherBayer          = "bayer"
+)
+
+// output image types of QuantizeFilter
+const (
+	QuantizeOutputGray     = "gray"
+	QuantizeOutputPaletted = "paletted"
+)
+
+const defaultQuantizeLevels = 16
+
+type QuantizeOption struct {
+	Levels int    // number of grey levels (2~256, default: 16)
+	Dither string // "none"(default), "floydSteinberg" or "bayer"
+	Output string // "gray"(default) : *image.Gray, "paletted" : *image.Paletted
+}
+
+func NewQuantizeOption(m map[string]interface{}) (*QuantizeOption, error) {
+	option := QuantizeOption{}
+
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+
+	if option.Levels != 0 && (option.Levels < 2 || option.Levels > 256) {
+		return nil, fmt.Errorf("invalid levels : %v", option.Levels)
+	}
+	switch option.Dither {
+	case "", DitherNone, DitherFloydSteinberg, DitherBayer:
+	default:
+		return nil, fmt.Errorf("invalid dither : %v", option.Dither)
+	}
+	switch option.Output {
+	case "", QuantizeOutputGray, QuantizeOutputPaletted:
+	default:
+		return nil, fmt.Errorf("invalid output : %v", option.Output)
+	}
+
+	return &option, nil
+}
+
+// QuantizedGray is a gray page of QuantizeFilter, whose dots have only the
+// grey levels of the device. Writers keep it without loss.
+type QuantizedGray struct {
+	*image.Gray
+}
+
+type QuantizeResult struct {
+	image image.Image
+}
+
+func (r QuantizeResult) Img() image.Image {
+	return r.image
+}
+
+func (r QuantizeResult) Log() {
+}
+
+// ----------------------------------------------------------------------------
+
+// QuantizeFilter reduces a page to grey levels of the device.
+// The pipeline fits the page to the device first if the device size is set,
+// so that the quantized dots are not resized again.
+type QuantizeFilter struct {
+	option  QuantizeOption
+	palette color.Palette
+}
+
+func NewQuantizeFilter(option QuantizeOption) *QuantizeFilter {
+	if option.Levels == 0 {
+		option.Levels = defaultQuantizeLevels
+	}
+	if option.Dither == "" {
+		option.Dither = DitherNone
+	}
+	if option.Output == "" {
+		option.Output = QuantizeOutputGray
+	}
+
+	palette := make(color.Palette, option.Levels)
+	for i := range palette {
+		palette[i] = color.Gray{levelValue(i, option.Levels)}
+	}
+	return &QuantizeFilter{option: option, palette: palette}
+}
+
+func init() {
+	RegisterFilter("quantize", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewQuantizeOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewQuantizeFilter(*option), nil
+	})
+}
+
+// Implements DeviceFilter.NeedsDeviceSize()
+func (f QuantizeFilter) NeedsDeviceSize() bool {
+	return true
+}
+
+// levelValue returns the brightness of level i.
+func levelValue(i, levels int) uint8 {
+	return uint8((i*255 + (levels-1)/2) / (levels - 1))
+}
+
+// Implements Filter.Run()
+func (f QuantizeFilter) Run(s *FilterSource) (FilterResult, error) {
+	gray := grayImage(s.image)
+
+	var indexes []uint8
+	switch f.option.Dither {
+	case DitherNone:
+		indexes = f.quantize(gray)
+	case DitherFloydSteinberg:
+		indexes = f.ditherFloydSteinberg(gray)
+	case DitherBayer:
+		indexes = f.ditherBayer(gray)
+	default:
+		return nil, fmt.Errorf("invalid dither : %v", f.option.Dither)
+	}
+
+	bounds := gray.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if f.option.Output == QuantizeOutputPaletted {
+		dest := image.NewPaletted(bounds, f.palette)
+		for y := 0; y < height; y++ {
+			copy(dest.Pix[y*dest.Stride:y*dest.Stride+width], indexes[y*width:(y+1)*width])
+		}
+		return QuantizeResult{dest}, nil
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			gray.Pix[y*gray.Stride+x] = levelValue(int(indexes[y*width+x]), f.option.Levels)
+		}
+	}
+	return QuantizeResult{&QuantizedGray{gray}}, nil
+}
+
+// nearestLevel returns the nearest level index of brightness v.
+func (f QuantizeFilter) nearestLevel(v float32) int {
+	levels := f.option.Levels
+	i := int(v*float32(levels-1)/255 + 0.5)
+	if i < 0 {
+		return 0
+	} else if i >= levels {
+		return levels - 1
+	}
+	return i
+}
+
+// quantize returns level indexes of dots without dithering.
+func (f QuantizeFilter) quantize(img *image.Gray) []uint8 {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	indexes := make([]uint8, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			indexes[y*width+x] = uint8(f.nearestLevel(float32(img.Pix[y*img.Stride+x])))
+		}
+	}
+	return indexes
+}
+
+// ditherFloydSteinberg diffuses quantization errors to neighbouring dots.
+func (f QuantizeFilter) ditherFloydSteinberg(img *image.Gray) []uint8 {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// errors of the current and the next row. 1 dot padding on both sides.
+	current := make([]float32, width+2)
+	next := make([]float32, width+2)
+
+	indexes := make([]uint8, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := float32(img.Pix[y*img.Stride+x]) + current[x+1]
+			i := f.nearestLevel(v)
+			indexes[y*width+x] = uint8(i)
+
+			e := v - float32(levelValue(i, f.option.Levels))
+			current[x+2] += e * 7 / 16
+			next[x] += e * 3 / 16
+			next[x+1] += e * 5 / 16
+			next[x+2] += e * 1 / 16
+		}
+		current, next = next, current
+		for i := range next {
+			next[i] = 0
+		}
+	}
+	return indexes
+}
+
+// bayerMatrix is the 8x8 ordered dithering matrix.
+var bayerMatrix = [8][8]float32{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// ditherBayer adds the ordered threshold pattern before quantization.
+func (f QuantizeFilter) ditherBayer(img *image.Gray) []uint8 {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	step := 255 / float32(f.option.Levels-1)
+
+	indexes := make([]uint8, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			offset := ((bayerMatrix[y%8][x%8]+0.5)/64 - 0.5) * step
+			v := float32(img.Pix[y*img.Stride+x]) + offset
+			indexes[y*width+x] = uint8(f.nearestLevel(v))
+		}
+	}
+	return indexes
+}
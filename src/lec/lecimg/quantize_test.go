@@ -0,0 +1,126 @@
+package lecimg
+
+import (
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newGradientPage creates a horizontal gradient from black to white.
+func newGradientPage() *image.RGBA {
+	img := CreateImage(256, 16, color.White)
+	for x := 0; x < 256; x++ {
+		DrawLine(img, x, 0, x, 16, color.Gray{uint8(x)})
+	}
+	return img
+}
+
+func TestQuantizeLevels(t *testing.T) {
+	for _, dither := range []string{DitherNone, DitherFloydSteinberg, DitherBayer} {
+		for _, levels := range []int{2, 4, 16} {
+			gray, ok := runTestFilter(t, NewQuantizeFilter(QuantizeOption{Levels: levels, Dither: dither}), newGradientPage()).Img().(*QuantizedGray)
+			if !ok {
+				t.Fatalf("gray image expected")
+			}
+
+			used := map[uint8]bool{}
+			for _, v := range gray.Pix {
+				used[v] = true
+			}
+			if len(used) != levels {
+				t.Errorf("level count mismatch. dither=%v, expected=%v, actual=%v", dither, levels, len(used))
+			}
+			for v := range used {
+				if v%uint8(255/(levels-1)) != 0 {
+					t.Errorf("value is not a level. dither=%v, levels=%v, value=%v", dither, levels, v)
+				}
+			}
+		}
+	}
+}
+
+func TestQuantizeDitherMean(t *testing.T) {
+	// dithering keeps the average brightness of mid-grey areas
+	for _, dither := range []string{DitherFloydSteinberg, DitherBayer} {
+		img := CreateImage(64, 64, color.Gray{96})
+		result := runTestFilter(t, NewQuantizeFilter(QuantizeOption{Levels: 2, Dither: dither}), img)
+
+		sum := 0
+		gray := result.Img().(*QuantizedGray)
+		for _, v := range gray.Pix {
+			sum += int(v)
+		}
+		if mean := sum / len(gray.Pix); mean < 86 || mean > 106 {
+			t.Errorf("mean mismatch. dither=%v, expected=96, actual=%v", dither, mean)
+		}
+	}
+}
+
+func TestQuantizePaletted(t *testing.T) {
+	paletted, ok := runTestFilter(t, NewQuantizeFilter(QuantizeOption{Levels: 4, Output: QuantizeOutputPaletted}), newGradientPage()).Img().(*image.Paletted)
+	if !ok {
+		t.Fatalf("paletted image expected")
+	}
+	if len(paletted.Palette) != 4 {
+		t.Errorf("palette size mismatch. actual=%v", len(paletted.Palette))
+	}
+	if _, ok := jpegImage(paletted).(*image.Gray); !ok {
+		t.Errorf("grey palette should be written as gray jpeg")
+	}
+}
+
+func TestQuantizeDeviceSize(t *testing.T) {
+	pipeline := NewPipeline(PassThroughOnError)
+	pipeline.AddFilter("quantize", NewQuantizeFilter(QuantizeOption{Levels: 4}), nil)
+	pipeline.SetDeviceSize(128, 128)
+
+	img, err := pipeline.Run(newGradientPage(), "filename", 0)
+	if err != nil || img == nil {
+		t.Fatalf("pipeline failed : %v", err)
+	}
+	if img.Bounds().Dx() != 128 {
+		t.Errorf("page should fit the device. actual=%v", img.Bounds())
+	}
+	if _, ok := img.(*QuantizedGray); !ok {
+		t.Errorf("quantized page should stay gray")
+	}
+	for x := 0; x < 128; x++ {
+		switch grayAt(img, x, 0) {
+		case 0, 85, 170, 255:
+		default:
+			t.Fatalf("dot (%v, 0) should keep one of the levels. actual=%v", x, grayAt(img, x, 0))
+		}
+	}
+}
+
+func TestSavePage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lecimg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	quantized := runTestFilter(t, NewQuantizeFilter(QuantizeOption{Levels: 4, Dither: DitherBayer}), newGradientPage()).Img()
+	filename, err := SavePage(quantized, dir, "p01.jpg", 80)
+	if err != nil || filename != "p01.png" {
+		t.Fatalf("quantized page should be saved as png. filename=%v, err=%v", filename, err)
+	}
+	img, err := LoadImage(filepath.Join(dir, filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameImage(grayImage(img), quantized) {
+		t.Errorf("quantized page should be saved without loss")
+	}
+
+	// other pages are smaller as jpeg even if they are gray
+	for _, page := range []image.Image{newGradientPage(), grayImage(newGradientPage())} {
+		filename, err = SavePage(page, dir, "p02.png", 80)
+		if err != nil || filename != "p02.jpg" {
+			t.Errorf("%T page should be saved as jpeg. filename=%v, err=%v", page, filename, err)
+		}
+	}
+}
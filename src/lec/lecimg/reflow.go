@@ -0,0 +1,381 @@
+package lecimg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"sort"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// default values of ReflowOption
+const (
+	defaultReflowMagnification   = 1.5
+	defaultReflowMargin          = 10
+	defaultReflowWordGapRate     = 0.3
+	defaultReflowWordSpacingRate = 0.4
+	defaultReflowLineSpacingRate = 0.3
+	defaultReflowFigureRate      = 3
+	defaultReflowIndentRate      = 0.8
+)
+
+type ReflowOption struct {
+	Threshold          uint8   // min brightness of space (0~255)
+	AutoThreshold      bool    // selects Threshold of each page by Otsu's method ("threshold: auto")
+	LockThreshold      bool    // uses one auto threshold for the book
+	Magnification      float32 // scale of words (default: 1.5)
+	Width              int     // output page width. the device width is used if 0
+	Height             int     // output page height. the device height is used if 0
+	Margin             int     // margin of output pages in pixels (default: 10)
+	EmptyLineThreshold float64 // max dot count of empty lines. rate of the width if less than 1
+	WordGapRate        float32 // min gap between words as rate of the line height (default: 0.3)
+	WordSpacingRate    float32 // space between output words as rate of the line height (default: 0.4)
+	LineSpacingRate    float32 // space between output lines as rate of the line height (default: 0.3)
+	FigureRate         float32 // lines taller than the line height times value are figures (default: 3)
+	IndentRate         float32 // lines indented by the line height times value start paragraphs (default: 0.8)
+}
+
+func NewReflowOption(m map[string]interface{}) (*ReflowOption, error) {
+	option := ReflowOption{}
+
+	m, auto := parseAutoThreshold(m)
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+	option.AutoThreshold = option.AutoThreshold || auto
+
+	if option.Magnification < 0 || option.Width < 0 || option.Height < 0 || option.Margin < 0 {
+		return nil, fmt.Errorf("invalid magnification or page size : magnification=%v, width=%v, height=%v, margin=%v",
+			option.Magnification, option.Width, option.Height, option.Margin)
+	}
+
+	return &option, nil
+}
+
+type ReflowResult struct {
+	thresholdResult
+	images []image.Image
+	words  int
+}
+
+func (r ReflowResult) Img() image.Image {
+	return r.images[0]
+}
+
+// Implements MultiPageResult.Imgs()
+func (r ReflowResult) Imgs() []image.Image {
+	return r.images
+}
+
+func (r ReflowResult) Log() {
+	r.logThreshold()
+	if r.words > 0 {
+		log.Printf("[REFLOW] %v : %v words, %v pages\n", r.filename, r.words, len(r.images))
+	}
+}
+
+func (r ReflowResult) Report(report *PageReport) {
+	r.reportThreshold(report)
+}
+
+// ----------------------------------------------------------------------------
+
+// ReflowFilter cuts text lines into words and lays the magnified words out
+// again in lines of the output page width, so that small print of scanned
+// pages becomes readable on small screens. Figures are kept as blocks.
+type ReflowFilter struct {
+	autoThresholdFilter
+	option ReflowOption
+}
+
+func NewReflowFilter(option ReflowOption) *ReflowFilter {
+	if option.Magnification == 0 {
+		option.Magnification = defaultReflowMagnification
+	}
+	if option.Margin == 0 {
+		option.Margin = defaultReflowMargin
+	}
+	if option.WordGapRate == 0 {
+		option.WordGapRate = defaultReflowWordGapRate
+	}
+	if option.WordSpacingRate == 0 {
+		option.WordSpacingRate = defaultReflowWordSpacingRate
+	}
+	if option.LineSpacingRate == 0 {
+		option.LineSpacingRate = defaultReflowLineSpacingRate
+	}
+	if option.FigureRate == 0 {
+		option.FigureRate = defaultReflowFigureRate
+	}
+	if option.IndentRate == 0 {
+		option.IndentRate = defaultReflowIndentRate
+	}
+
+	return &ReflowFilter{
+		option:              option,
+		autoThresholdFilter: autoThresholdFilter{newAutoThreshold(option.AutoThreshold, option.LockThreshold)},
+	}
+}
+
+func init() {
+	RegisterFilter("reflow", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewReflowOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewReflowFilter(*option), nil
+	})
+}
+
+// Implements Filter.Run()
+func (f ReflowFilter) Run(s *FilterSource) (FilterResult, error) {
+	width, height := f.option.Width, f.option.Height
+	if width == 0 || height == 0 {
+		width, height = s.deviceWidth, s.deviceHeight
+	}
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("reflow needs width and height options or the device size")
+	}
+	if width <= f.option.Margin*2 || height <= f.option.Margin*2 {
+		return nil, fmt.Errorf("margin is too large for the page : %vx%v", width, height)
+	}
+
+	if f.threshold.enabled() {
+		f.option.Threshold = f.threshold.get(s.image)
+	}
+	threshold := thresholdResult{s.filename, f.threshold.enabled(), f.option.Threshold}
+
+	src := cropImage(s.image, s.image.Bounds())
+	blocks, words := f.findBlocks(src)
+	if words == 0 {
+		return ReflowResult{threshold, []image.Image{s.image}, 0}, nil
+	}
+	_, gray := s.image.(*image.Gray)
+	return ReflowResult{threshold, f.layout(blocks, width, height, gray), words}, nil
+}
+
+// reflowBlock is a word or a figure in reading order.
+type reflowBlock struct {
+	image     image.Image
+	ascent    int  // height above the baseline. the whole height for figures
+	figure    bool // laid out alone at the left margin
+	paragraph bool // starts a new line
+	indent    int  // indent of the paragraph in source pixels
+}
+
+// findBlocks cuts the page into words and figures and returns them with the number of words.
+// Text lines are found like changeLineSpace, and words are separated by
+// runs of empty columns wider than WordGapRate of the median line height.
+func (f ReflowFilter) findBlocks(src image.Image) ([]reflowBlock, int) {
+	bounds := src.Bounds()
+	width := bounds.Dx()
+	thresholdSum := uint32(f.option.Threshold) * 256 * 3
+	isDark := func(x, y int) bool {
+		r, g, b, _ := src.At(x, y).RGBA()
+		return r+g+b < thresholdSum
+	}
+
+	var lines []span
+	var heights []int
+	for _, r := range findLineRanges(src, uint32(f.option.Threshold), f.option.EmptyLineThreshold) {
+		if !r.emptyLine {
+			lines = append(lines, span{r.start, r.end + 1})
+			heights = append(heights, r.end+1-r.start)
+		}
+	}
+	if len(lines) == 0 {
+		return nil, 0
+	}
+	sort.Ints(heights)
+	lineHeight := heights[len(heights)/2]
+	minGap := Max(1, int(float32(lineHeight)*f.option.WordGapRate))
+	minIndent := int(float32(lineHeight) * f.option.IndentRate)
+
+	// dark columns and rows of each line
+	columns := make([][]int, len(lines))
+	blockLeft, blockRight := width, 0
+	for i, line := range lines {
+		columns[i] = make([]int, width)
+		for y := line.start; y < line.end; y++ {
+			for x := 0; x < width; x++ {
+				if isDark(x, y) {
+					columns[i][x]++
+					blockLeft, blockRight = Min(blockLeft, x), Max(blockRight, x+1)
+				}
+			}
+		}
+	}
+
+	var blocks []reflowBlock
+	words := 0
+	shortLine := true // the previous line ends before the right edge of the text block
+	for i, line := range lines {
+		var boxes []span
+		start, gap := -1, 0
+		for x := 0; x <= width; x++ {
+			dark := x < width && columns[i][x] > 0
+			if dark {
+				if start < 0 {
+					start = x
+				}
+				gap = 0
+			} else if start >= 0 {
+				gap++
+				if gap >= minGap || x == width {
+					boxes = append(boxes, span{start, x - gap + 1})
+					start = -1
+				}
+			}
+		}
+		if len(boxes) == 0 {
+			continue
+		}
+
+		if line.end-line.start > int(float32(lineHeight)*f.option.FigureRate) {
+			rect := image.Rect(boxes[0].start, line.start, boxes[len(boxes)-1].end, line.end)
+			blocks = append(blocks, reflowBlock{image: cropImage(src, rect), ascent: rect.Dy(), figure: true})
+			shortLine = true
+			continue
+		}
+
+		// the baseline is the bottom of the densest rows
+		rows := make([]int, line.end-line.start)
+		peak := 0
+		for y := range rows {
+			for x := boxes[0].start; x < boxes[len(boxes)-1].end; x++ {
+				if isDark(x, line.start+y) {
+					rows[y]++
+				}
+			}
+			peak = Max(peak, rows[y])
+		}
+		baseline := len(rows)
+		for baseline > 1 && rows[baseline-1]*2 < peak {
+			baseline--
+		}
+
+		indent := boxes[0].start - blockLeft
+		paragraph := indent >= minIndent || shortLine
+		for j, box := range boxes {
+			block := reflowBlock{
+				image:  cropImage(src, image.Rect(box.start, line.start, box.end, line.end)),
+				ascent: baseline,
+			}
+			if j == 0 && paragraph {
+				block.paragraph = true
+				if indent >= minIndent {
+					block.indent = indent
+				}
+			}
+			blocks = append(blocks, block)
+			words++
+		}
+		shortLine = blockRight-boxes[len(boxes)-1].end > lineHeight*2
+	}
+	return blocks, words
+}
+
+// layout places blocks in lines of width x height pages.
+func (f ReflowFilter) layout(blocks []reflowBlock, width, height int, gray bool) []image.Image {
+	o := f.option
+	scale := float64(o.Magnification)
+	margin := o.Margin
+	lineWidth := width - margin*2
+
+	var pages []image.Image
+	var page draw.Image
+	y := margin
+	newPage := func() {
+		if gray {
+			page = image.NewGray(image.Rect(0, 0, width, height))
+		} else {
+			page = image.NewRGBA(image.Rect(0, 0, width, height))
+		}
+		draw.Draw(page, page.Bounds(), &image.Uniform{color.White}, image.ZP, draw.Src)
+		pages = append(pages, page)
+		y = margin
+	}
+
+	// placed blocks of the current line
+	type placed struct {
+		image  image.Image
+		x      int
+		ascent int
+	}
+	var line []placed
+	x, lineAscent, lineDescent, lineSpacing := margin, 0, 0, 0
+	flush := func() {
+		if len(line) == 0 {
+			return
+		}
+		if page == nil || (y+lineAscent+lineDescent > height-margin && y > margin) {
+			newPage()
+		}
+		for _, p := range line {
+			top := y + lineAscent - p.ascent
+			bounds := p.image.Bounds()
+			draw.Draw(page, image.Rect(p.x, top, p.x+bounds.Dx(), top+bounds.Dy()), p.image, bounds.Min, draw.Src)
+		}
+		y += lineAscent + lineDescent + lineSpacing
+		line = line[:0]
+		x, lineAscent, lineDescent = margin, 0, 0
+	}
+	resize := func(img image.Image, scale float64) image.Image {
+		bounds := img.Bounds()
+		w, h := Max(1, int(float64(bounds.Dx())*scale+0.5)), Max(1, int(float64(bounds.Dy())*scale+0.5))
+		if w == bounds.Dx() && h == bounds.Dy() {
+			return img
+		}
+		return ResizeImage(img, w, h, false)
+	}
+
+	for _, block := range blocks {
+		bounds := block.image.Bounds()
+		if block.figure {
+			flush()
+			figureScale := scale
+			figureScale = minFloat64(figureScale, float64(lineWidth)/float64(bounds.Dx()))
+			figureScale = minFloat64(figureScale, float64(height-margin*2)/float64(bounds.Dy()))
+			img := resize(block.image, figureScale)
+			line = append(line, placed{img, margin, img.Bounds().Dy()})
+			lineAscent = img.Bounds().Dy()
+			flush()
+			continue
+		}
+
+		// words wider than the line are shrunk
+		wordScale := minFloat64(scale, float64(lineWidth)/float64(bounds.Dx()))
+		img := resize(block.image, wordScale)
+		ascent := int(float64(block.ascent)*wordScale + 0.5)
+		descent := img.Bounds().Dy() - ascent
+		spacing := int(float64(bounds.Dy()) * float64(o.WordSpacingRate) * wordScale)
+		lineSpacing = int(float64(bounds.Dy()) * float64(o.LineSpacingRate) * wordScale)
+
+		if block.paragraph {
+			flush()
+			x = margin + Min(int(float64(block.indent)*scale), lineWidth/4)
+		} else if len(line) > 0 {
+			x += spacing
+		}
+		if x+img.Bounds().Dx() > width-margin && len(line) > 0 {
+			flush()
+		}
+		line = append(line, placed{img, x, ascent})
+		x += img.Bounds().Dx()
+		lineAscent, lineDescent = Max(lineAscent, ascent), Max(lineDescent, descent)
+	}
+	flush()
+	return pages
+}
+
+func minFloat64(x, y float64) float64 {
+	if x < y {
+		return x
+	}
+	return y
+}
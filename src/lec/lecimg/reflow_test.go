@@ -0,0 +1,99 @@
+package lecimg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// createReflowPage draws two paragraphs of 40x10 words and a figure between them.
+// Paragraphs start with an indent of 30 dots.
+func createReflowPage() *image.RGBA {
+	img := CreateImage(600, 400, color.White)
+	drawParagraph := func(top, lines int) {
+		for i := 0; i < lines; i++ {
+			y := top + i*20
+			left := 50
+			if i == 0 {
+				left = 80
+			}
+			for x := left; x+40 <= 550; x += 50 {
+				FillRect(img, x, y, x+40, y+10, color.Black)
+			}
+		}
+	}
+	drawParagraph(40, 3)
+	FillRect(img, 100, 120, 500, 220, color.Black) // figure
+	drawParagraph(260, 4)
+	return img
+}
+
+func TestReflow(t *testing.T) {
+	result := runTestFilter(t, NewReflowFilter(ReflowOption{Threshold: 128, Width: 300, Height: 200}), createReflowPage()).(ReflowResult)
+
+	// 9 + 10 + 10 words in the first paragraph, 9 + 10 * 3 in the second
+	if result.words != 68 {
+		t.Errorf("word count mismatch. expected=68, actual=%v", result.words)
+	}
+	pages := result.Imgs()
+	if len(pages) < 2 {
+		t.Fatalf("words should spill to several pages. pages=%v", len(pages))
+	}
+	for i, page := range pages {
+		if page.Bounds() != image.Rect(0, 0, 300, 200) {
+			t.Errorf("page %v size mismatch. actual=%v", i, page.Bounds())
+		}
+	}
+
+	// the first word is magnified to 60x15 and indented by 45 dots
+	first := pages[0]
+	if isDark(first, 54, 14) || !isDark(first, 56, 11) || !isDark(first, 114, 24) || isDark(first, 116, 24) {
+		t.Errorf("first word should be indented and magnified")
+	}
+	// 3 words fit in the first line after the indent, the second line starts at the margin
+	if !isDark(first, 11, 40) {
+		t.Errorf("second line should start at the margin")
+	}
+
+	// the figure is shrunk to the line width
+	found := false
+	for _, page := range pages {
+		for y := 0; y < 200 && !found; y++ {
+			dark := 0
+			for x := 0; x < 300; x++ {
+				if isDark(page, x, y) {
+					dark++
+				}
+			}
+			found = dark == 280
+		}
+	}
+	if !found {
+		t.Errorf("figure should be kept in a block of the line width")
+	}
+}
+
+func TestReflowDeviceSize(t *testing.T) {
+	src := grayImage(createReflowPage())
+	s := NewFilterSource(src, "filename", 0)
+	s.deviceWidth, s.deviceHeight = 200, 300
+
+	result := runTestFilterSource(t, NewReflowFilter(ReflowOption{Threshold: 128}), s).(ReflowResult)
+	for i, page := range result.Imgs() {
+		if _, ok := page.(*image.Gray); !ok || page.Bounds() != image.Rect(0, 0, 200, 300) {
+			t.Errorf("page %v should be gray of the device size. actual=%v", i, page.Bounds())
+		}
+	}
+
+	if _, err := NewReflowFilter(ReflowOption{Threshold: 128}).Run(NewFilterSource(src, "filename", 0)); err == nil {
+		t.Errorf("reflow without page size should fail")
+	}
+}
+
+func TestReflowBlankPage(t *testing.T) {
+	src := CreateImage(600, 400, color.White)
+	result := runTestFilter(t, NewReflowFilter(ReflowOption{Threshold: 128, Width: 300, Height: 200}), src).(ReflowResult)
+	if len(result.Imgs()) != 1 || result.Img() != image.Image(src) {
+		t.Errorf("blank page should not be changed")
+	}
+}
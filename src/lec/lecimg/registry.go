@@ -0,0 +1,42 @@
+package lecimg
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FilterFactory decodes filter options and creates a Filter.
+type FilterFactory func(options map[string]interface{}) (Filter, error)
+
+var filterFactories = make(map[string]FilterFactory)
+
+// RegisterFilter registers a filter factory with given name.
+// It panics if the name is already registered.
+func RegisterFilter(name string, factory FilterFactory) {
+	if _, exists := filterFactories[name]; exists {
+		panic("lecimg: filter already registered : " + name)
+	}
+	filterFactories[name] = factory
+}
+
+// NewFilter creates a filter registered with given name.
+func NewFilter(name string, options map[string]interface{}) (Filter, error) {
+	factory, ok := filterFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown filter name : %v", name)
+	}
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+	return factory(options)
+}
+
+// FilterNames returns registered filter names in ascending order.
+func FilterNames() []string {
+	var names []string
+	for name := range filterFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
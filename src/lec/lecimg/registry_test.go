@@ -0,0 +1,78 @@
+package lecimg
+
+import (
+	"testing"
+)
+
+func TestFilterNames(t *testing.T) {
+	expected := []string{
+		"autoCrop",
+		"autoCropED",
+		"binarize",
+		"changeLineSpace",
+		"deskew",
+		"deskewED",
+		"despeckle",
+		"dewarp",
+		"flatten",
+		"orient",
+		"panels",
+		"perspective",
+		"quantize",
+		"reflow",
+		"removeBlank",
+		"removeBorder",
+		"resize",
+		"splitColumns",
+		"splitSpread",
+		"splitTall",
+		"tone",
+		"watermark",
+	}
+
+	names := FilterNames()
+	if len(names) != len(expected) {
+		t.Fatalf("filter count mismatch. expected=%v, actual=%v", expected, names)
+	}
+	for i, name := range expected {
+		if names[i] != name {
+			t.Errorf("filter name mismatch. expected=%v, actual=%v", name, names[i])
+		}
+	}
+}
+
+func TestNewFilter(t *testing.T) {
+	filter, err := NewFilter("autoCrop", map[string]interface{}{
+		"threshold": 200,
+		"marginTop": 5,
+	})
+	if err != nil {
+		t.Fatalf("failed to create filter : %v", err)
+	}
+
+	autoCrop, ok := filter.(*AutoCropFilter)
+	if !ok {
+		t.Fatalf("filter type mismatch. actual=%T", filter)
+	}
+	if autoCrop.option.Threshold != 200 || autoCrop.option.MarginTop != 5 {
+		t.Errorf("option mismatch. actual=%+v", autoCrop.option)
+	}
+}
+
+func TestNewFilterNilOptions(t *testing.T) {
+	if _, err := NewFilter("deskew", nil); err != nil {
+		t.Errorf("failed to create filter : %v", err)
+	}
+}
+
+func TestNewFilterUnknownName(t *testing.T) {
+	if _, err := NewFilter("unknown", nil); err == nil {
+		t.Errorf("error expected for unknown filter name")
+	}
+}
+
+func TestNewFilterInvalidOption(t *testing.T) {
+	if _, err := NewFilter("resize", map[string]interface{}{"widthScale": "wide"}); err == nil {
+		t.Errorf("error expected for invalid option")
+	}
+}
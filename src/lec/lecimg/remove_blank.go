@@ -0,0 +1,150 @@
+package lecimg
+
+import (
+	"image"
+	"log"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// default values of RemoveBlankOption
+const (
+	defaultRemoveBlankThreshold = 128
+	defaultMaxInkRate           = 0.001
+)
+
+type RemoveBlankOption struct {
+	Threshold            uint8   // min brightness of space (0~255, default: 128)
+	AutoThreshold        bool    // selects Threshold of each page by Otsu's method ("threshold: auto")
+	LockThreshold        bool    // uses one auto threshold for the book
+	EmptyLineMaxDotCount int     // dots of lines with fewer dots are not counted as ink
+	MaxInkRate           float32 // pages with lower rate of ink dots are blank (default: 0.001)
+	PaddingTop           int     // ignored area at the edges, e.g. scanner shadows
+	PaddingBottom        int
+	PaddingLeft          int
+	PaddingRight         int
+	MoveTo               string // saves blank pages to this directory if not empty
+}
+
+func NewRemoveBlankOption(m map[string]interface{}) (*RemoveBlankOption, error) {
+	option := RemoveBlankOption{}
+
+	m, auto := parseAutoThreshold(m)
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+	option.AutoThreshold = option.AutoThreshold || auto
+
+	return &option, nil
+}
+
+type RemoveBlankResult struct {
+	thresholdResult
+	images  []image.Image
+	inkRate float32
+}
+
+func (r RemoveBlankResult) Img() image.Image {
+	if len(r.images) == 0 {
+		return nil
+	}
+	return r.images[0]
+}
+
+// Implements MultiPageResult.Imgs()
+func (r RemoveBlankResult) Imgs() []image.Image {
+	return r.images
+}
+
+func (r RemoveBlankResult) Log() {
+	r.logThreshold()
+	if len(r.images) == 0 {
+		log.Printf("[BLANK] %v : ink %.4f%%\n", r.filename, r.inkRate*100)
+	}
+}
+
+func (r RemoveBlankResult) Report(report *PageReport) {
+	r.reportThreshold(report)
+}
+
+// ----------------------------------------------------------------------------
+
+// RemoveBlankFilter drops pages with little ink such as blank backs of plates.
+type RemoveBlankFilter struct {
+	autoThresholdFilter
+	option RemoveBlankOption
+}
+
+func NewRemoveBlankFilter(option RemoveBlankOption) *RemoveBlankFilter {
+	// no dot is darker than threshold 0, so every page would be blank
+	if option.Threshold == 0 {
+		option.Threshold = defaultRemoveBlankThreshold
+	}
+	if option.MaxInkRate == 0 {
+		option.MaxInkRate = defaultMaxInkRate
+	}
+	return &RemoveBlankFilter{
+		option:              option,
+		autoThresholdFilter: autoThresholdFilter{newAutoThreshold(option.AutoThreshold, option.LockThreshold)},
+	}
+}
+
+func init() {
+	RegisterFilter("removeBlank", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewRemoveBlankOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewRemoveBlankFilter(*option), nil
+	})
+}
+
+// Implements Filter.Run()
+func (f RemoveBlankFilter) Run(s *FilterSource) (FilterResult, error) {
+	if f.threshold.enabled() {
+		f.option.Threshold = f.threshold.get(s.image)
+	}
+	threshold := thresholdResult{s.filename, f.threshold.enabled(), f.option.Threshold}
+
+	inkRate := f.inkRate(s.image)
+	if inkRate >= f.option.MaxInkRate {
+		return RemoveBlankResult{threshold, []image.Image{s.image}, inkRate}, nil
+	}
+
+	// pages are not moved twice in the analysis pass.
+	// the filename of a page split from a source page is like "p01-002.jpg".
+	if f.option.MoveTo != "" && !s.analysis {
+		quality := s.pageQuality
+		if quality == 0 {
+			quality = DefaultPageQuality
+		}
+		if _, err := SavePage(s.image, f.option.MoveTo, strings.ToLower(s.filename), quality); err != nil {
+			return nil, err
+		}
+	}
+	return RemoveBlankResult{threshold, nil, inkRate}, nil
+}
+
+// inkRate returns the rate of dark dots in the padded area.
+// Lines which autoCrop regards as empty are not counted.
+func (f RemoveBlankFilter) inkRate(src image.Image) float32 {
+	bounds := src.Bounds()
+	o := f.option
+
+	xStart, xEnd := bounds.Min.X+o.PaddingLeft, bounds.Max.X-o.PaddingRight
+	yStart, yEnd := bounds.Min.Y+o.PaddingTop, bounds.Max.Y-o.PaddingBottom
+	if xStart >= xEnd || yStart >= yEnd {
+		return 0
+	}
+
+	thresholdSum := uint32(o.Threshold) * 256 * 3
+	inkCount := 0
+	for y := yStart; y < yEnd; y++ {
+		if dotCount := countLineDots(src, y, xStart, xEnd, thresholdSum, -1); dotCount > o.EmptyLineMaxDotCount {
+			inkCount += dotCount
+		}
+	}
+	return float32(inkCount) / float32((xEnd-xStart)*(yEnd-yStart))
+}
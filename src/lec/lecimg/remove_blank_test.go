@@ -0,0 +1,102 @@
+package lecimg
+
+import (
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveBlank(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	blank := CreateImage(200, 300, color.White)
+	FillRect(blank, 0, 0, 10, 300, color.Black) // scanner shadow
+	blank.Set(100, 100, color.Black)            // speck
+
+	text := CreateImage(200, 300, color.White)
+	FillRect(text, 50, 50, 150, 60, color.Black)
+
+	pipeline := NewPipeline(AbortOnError)
+	pipeline.AddFilter("removeBlank", NewRemoveBlankFilter(RemoveBlankOption{
+		Threshold:            128,
+		EmptyLineMaxDotCount: 1,
+		PaddingLeft:          10,
+		MoveTo:               dir,
+	}), nil)
+
+	if pages, err := pipeline.RunPages(blank, "Blank.png", 0); err != nil || len(pages) != 0 {
+		t.Errorf("blank page should be dropped. pages=%v, err=%v", len(pages), err)
+	}
+	if pages, err := pipeline.RunPages(text, "text.png", 1); err != nil || len(pages) != 1 {
+		t.Errorf("text page should be kept. pages=%v, err=%v", len(pages), err)
+	}
+
+	dropped := pipeline.Summary().Dropped()
+	if len(dropped) != 1 || dropped[0].Filename != "Blank.png" || dropped[0].FilterName != "removeBlank" {
+		t.Errorf("dropped pages mismatch. actual=%v", dropped)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "blank.jpg")); err != nil {
+		t.Errorf("blank page should be moved : %v", err)
+	}
+}
+
+func TestRemoveBlankDefaultOption(t *testing.T) {
+	text := CreateImage(200, 300, color.White)
+	FillRect(text, 50, 50, 150, 60, color.Black)
+
+	for _, m := range []map[string]interface{}{{}, {"threshold": "auto"}} {
+		option, err := NewRemoveBlankOption(m)
+		if err != nil {
+			t.Fatalf("failed to parse option : %v", err)
+		}
+		filter := NewRemoveBlankFilter(*option)
+		if pages := runTestFilter(t, filter, text).(RemoveBlankResult).Imgs(); len(pages) != 1 {
+			t.Errorf("%v : text page should be kept", m)
+		}
+		if pages := runTestFilter(t, filter, CreateImage(200, 300, color.White)).(RemoveBlankResult).Imgs(); len(pages) != 0 {
+			t.Errorf("%v : blank page should be dropped", m)
+		}
+	}
+}
+
+func TestRemoveBlankSplitPages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pipeline := NewPipeline(AbortOnError)
+	pipeline.AddFilter("splitSpread", NewSplitSpreadFilter(SplitSpreadOption{Threshold: 128, ForceCenter: true}), nil)
+	pipeline.AddFilter("removeBlank", NewRemoveBlankFilter(RemoveBlankOption{Threshold: 128, MoveTo: dir}), nil)
+	pipeline.AddFilter("autoCrop", NewAutoCropFilter(AutoCropOption{Threshold: 128, UniformCrop: UniformCropBook}), nil)
+	pipeline.SetPageCount(1)
+
+	spread := CreateImage(400, 300, color.White)
+	pipeline.Analyze(spread, "p01.jpg", 0)
+	pipeline.EndAnalysis()
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("blank pages should not be moved in the analysis pass. files=%v", len(files))
+	}
+
+	if pages, err := pipeline.RunPages(spread, "p01.jpg", 0); err != nil || len(pages) != 0 {
+		t.Errorf("blank pages should be dropped. pages=%v, err=%v", len(pages), err)
+	}
+
+	// each page of the spread is dropped and moved
+	dropped := pipeline.Summary().Dropped()
+	if len(dropped) != 2 || dropped[0].Filename != "p01-001.jpg" || dropped[1].Filename != "p01-002.jpg" {
+		t.Errorf("dropped pages mismatch. actual=%v", dropped)
+	}
+	for _, filename := range []string{"p01-001.jpg", "p01-002.jpg"} {
+		if _, err := os.Stat(filepath.Join(dir, filename)); err != nil {
+			t.Errorf("blank page should be moved : %v", err)
+		}
+	}
+}
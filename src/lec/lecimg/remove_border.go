@@ -0,0 +1,194 @@
+package lecimg
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// default values of RemoveBorderOption
+const (
+	defaultBorderMaxWidthRate  = 0.1
+	defaultBorderMinLengthRate = 0.5
+)
+
+type RemoveBorderOption struct {
+	Threshold       uint8   // max brightness of band dots (0~255)
+	MaxWidth        int     // max band width in pixels. MaxWidthRate is used if 0
+	MaxWidthRate    float32 // max band width as rate of page width or height (default: 0.1)
+	MinLengthRate   float32 // min band length as rate of the edge length (default: 0.5)
+	ShadowTolerance uint8   // max brightness step of gradual shadows following the band. 0 disables shadows
+}
+
+func NewRemoveBorderOption(m map[string]interface{}) (*RemoveBorderOption, error) {
+	option := RemoveBorderOption{}
+
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+	if option.MaxWidth < 0 || option.MaxWidthRate < 0 || option.MaxWidthRate > 0.5 {
+		return nil, fmt.Errorf("invalid max band width : maxWidth=%v, maxWidthRate=%v",
+			option.MaxWidth, option.MaxWidthRate)
+	}
+	if option.MinLengthRate < 0 || option.MinLengthRate > 1 {
+		return nil, fmt.Errorf("invalid minLengthRate : %v", option.MinLengthRate)
+	}
+
+	return &option, nil
+}
+
+type RemoveBorderResult struct {
+	image    image.Image
+	filename string
+	widths   [4]int // top, bottom, left, right
+}
+
+func (r RemoveBorderResult) Img() image.Image {
+	return r.image
+}
+
+func (r RemoveBorderResult) Log() {
+	if r.widths != [4]int{} {
+		log.Printf("[BORDER] %v : top=%v, bottom=%v, left=%v, right=%v\n",
+			r.filename, r.widths[0], r.widths[1], r.widths[2], r.widths[3])
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// RemoveBorderFilter paints dark bands connected to the page edges
+// with the background color, so that autoCrop does not regard them as content.
+type RemoveBorderFilter struct {
+	option RemoveBorderOption
+}
+
+func NewRemoveBorderFilter(option RemoveBorderOption) *RemoveBorderFilter {
+	if option.MaxWidthRate == 0 {
+		option.MaxWidthRate = defaultBorderMaxWidthRate
+	}
+	if option.MinLengthRate == 0 {
+		option.MinLengthRate = defaultBorderMinLengthRate
+	}
+	return &RemoveBorderFilter{option: option}
+}
+
+func init() {
+	RegisterFilter("removeBorder", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewRemoveBorderOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewRemoveBorderFilter(*option), nil
+	})
+}
+
+// borderScan describes how to walk from an edge of the page into it.
+type borderScan struct {
+	lines  int // number of scan lines along the edge
+	length int // length of a scan line
+	point  func(line, step int) (x, y int)
+}
+
+// Implements Filter.Run()
+func (f RemoveBorderFilter) Run(s *FilterSource) (FilterResult, error) {
+	src := s.image
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	thresholdSum := uint32(f.option.Threshold) * 256 * 3
+
+	brightness := make([]uint8, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			brightness[y*width+x] = uint8(getBrightness(r, g, b) >> 8)
+		}
+	}
+
+	scans := [4]borderScan{
+		{width, height, func(line, step int) (int, int) { return line, step }},
+		{width, height, func(line, step int) (int, int) { return line, height - 1 - step }},
+		{height, width, func(line, step int) (int, int) { return step, line }},
+		{height, width, func(line, step int) (int, int) { return width - 1 - step, line }},
+	}
+
+	background := backgroundAround(src, bounds, thresholdSum)
+	r, g, b, _ := background.RGBA()
+	backgroundBrightness := uint8(getBrightness(r, g, b) >> 8)
+
+	var dest draw.Image
+	var widths [4]int
+	for side, scan := range scans {
+		bands := f.findBands(brightness, width, scan, backgroundBrightness)
+		for line, band := range bands {
+			if band == 0 {
+				continue
+			}
+			if dest == nil {
+				dest = cropImage(src, bounds).(draw.Image)
+			}
+			for step := 0; step < band; step++ {
+				x, y := scan.point(line, step)
+				dest.Set(x, y, background)
+			}
+			widths[side] = Max(widths[side], band)
+		}
+	}
+
+	if dest == nil {
+		return RemoveBorderResult{src, s.filename, widths}, nil
+	}
+	return RemoveBorderResult{dest, s.filename, widths}, nil
+}
+
+// findBands returns the band width of each scan line.
+// A band consists of dots darker than Threshold from the edge, followed by
+// a shadow which gets lighter towards the background. The shadow ends at dots
+// lighter than background - ShadowTolerance or darker than the previous dot
+// by more than ShadowTolerance.
+// It returns nil if the band is shorter than MinLengthRate of the edge.
+func (f RemoveBorderFilter) findBands(brightness []uint8, width int, scan borderScan, background uint8) []int {
+	o := f.option
+	maxWidth := o.MaxWidth
+	if maxWidth == 0 {
+		maxWidth = int(float32(scan.length) * o.MaxWidthRate)
+	}
+	maxWidth = Min(maxWidth, scan.length)
+
+	tolerance := int(o.ShadowTolerance)
+	shadowLimit := int(background) - tolerance
+
+	bands := make([]int, scan.lines)
+	bandLines := 0
+	for line := 0; line < scan.lines; line++ {
+		band := 0
+		prev := -1
+		inShadow := false
+		for step := 0; step < maxWidth; step++ {
+			x, y := scan.point(line, step)
+			v := int(brightness[y*width+x])
+
+			if inShadow || v >= int(o.Threshold) {
+				// content after the shadow is darker than the shadow itself
+				if tolerance == 0 || v >= shadowLimit || (prev >= 0 && v+tolerance < prev) {
+					break
+				}
+				inShadow = true
+			}
+			band = step + 1
+			prev = v
+		}
+		bands[line] = band
+		if band > 0 {
+			bandLines++
+		}
+	}
+
+	if float32(bandLines) < float32(scan.lines)*o.MinLengthRate {
+		return nil
+	}
+	return bands
+}
@@ -0,0 +1,55 @@
+package lecimg
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestRemoveBorder(t *testing.T) {
+	img := CreateImage(200, 300, color.White)
+	FillRect(img, 0, 0, 12, 300, color.Black)    // scanner lid band
+	FillRect(img, 30, 50, 170, 250, color.Black) // text
+	FillRect(img, 190, 0, 200, 40, color.Black)  // picture touching the edge
+
+	result := runTestFilter(t, NewRemoveBorderFilter(RemoveBorderOption{Threshold: 128}), img).(RemoveBorderResult)
+	if result.widths != [4]int{0, 0, 12, 0} {
+		t.Errorf("band widths mismatch. actual=%v", result.widths)
+	}
+	if isDark(result.Img(), 5, 100) {
+		t.Errorf("band should be painted")
+	}
+	if !isDark(result.Img(), 30, 100) || !isDark(result.Img(), 195, 10) {
+		t.Errorf("content should be kept")
+	}
+}
+
+func TestRemoveBorderMaxWidth(t *testing.T) {
+	img := CreateImage(200, 300, color.White)
+	FillRect(img, 0, 0, 50, 300, color.Black)
+
+	result := runTestFilter(t, NewRemoveBorderFilter(RemoveBorderOption{Threshold: 128, MaxWidth: 20}), img).(RemoveBorderResult)
+	if result.widths[2] != 20 || !isDark(result.Img(), 30, 100) {
+		t.Errorf("band should be limited to max width. actual=%v", result.widths)
+	}
+}
+
+func TestRemoveBorderShadow(t *testing.T) {
+	img := CreateImage(200, 300, color.White)
+	FillRect(img, 0, 0, 10, 300, color.Black)
+	for x := 10; x < 30; x++ {
+		DrawLine(img, x, 0, x, 300, color.Gray{uint8(60 + (x-10)*9)}) // gradual shadow
+	}
+	FillRect(img, 30, 0, 40, 300, color.Gray{40}) // text right after the shadow
+
+	if result := runTestFilter(t, NewRemoveBorderFilter(RemoveBorderOption{Threshold: 128}), img).(RemoveBorderResult); result.widths[2] != 18 {
+		t.Errorf("only dark dots should be removed without shadow tolerance. actual=%v", result.widths)
+	}
+
+	result := runTestFilter(t, NewRemoveBorderFilter(RemoveBorderOption{Threshold: 128, MaxWidth: 40, ShadowTolerance: 16}), img).(RemoveBorderResult)
+	if result.widths[2] != 30 {
+		t.Errorf("shadow should be removed. actual=%v", result.widths)
+	}
+	if !isDark(result.Img(), 35, 100) {
+		t.Errorf("text after the shadow should be kept")
+	}
+}
@@ -0,0 +1,208 @@
+package lecimg
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lec/lecio"
+)
+
+// ReportRect is a rectangle in the page report.
+type ReportRect struct {
+	Left   int `json:"left"`
+	Top    int `json:"top"`
+	Right  int `json:"right"`
+	Bottom int `json:"bottom"`
+}
+
+// NewReportRect creates an instance of ReportRect
+func NewReportRect(rect image.Rectangle) *ReportRect {
+	return &ReportRect{
+		Left:   rect.Min.X,
+		Top:    rect.Min.Y,
+		Right:  rect.Max.X,
+		Bottom: rect.Max.Y,
+	}
+}
+
+// PageReport contains the facts of a processed page.
+type PageReport struct {
+	Filename         string      `json:"filename"`
+	Index            int         `json:"index"`
+	InputWidth       int         `json:"inputWidth"`
+	InputHeight      int         `json:"inputHeight"`
+	OutputWidth      int         `json:"outputWidth"`
+	OutputHeight     int         `json:"outputHeight"`
+	OutputPages      int         `json:"outputPages"`
+	Filters          []string    `json:"filters"`
+	SkewAngle        *float32    `json:"skewAngle,omitempty"`
+	Orientation      *int        `json:"orientation,omitempty"`
+	OrientConfidence *float32    `json:"orientConfidence,omitempty"`
+	CropRect         *ReportRect `json:"cropRect,omitempty"`
+	LineSpaceRanges  int         `json:"lineSpaceRanges"`
+	Threshold        *int        `json:"threshold,omitempty"`
+	DurationMillis   int64       `json:"durationMillis"`
+	Error            string      `json:"error,omitempty"`
+}
+
+// ReportableResult is a FilterResult which adds facts to the page report.
+type ReportableResult interface {
+	Report(r *PageReport)
+}
+
+func newPageReport(src image.Image, filename string, index int) *PageReport {
+	bounds := src.Bounds()
+	return &PageReport{
+		Filename:    filename,
+		Index:       index,
+		InputWidth:  bounds.Dx(),
+		InputHeight: bounds.Dy(),
+		Filters:     []string{},
+	}
+}
+
+// setOutput sets the size of the first output page and the number of pages.
+func (r *PageReport) setOutput(pages []image.Image, startTime time.Time) {
+	if len(pages) > 0 {
+		bounds := pages[0].Bounds()
+		r.OutputWidth, r.OutputHeight = bounds.Dx(), bounds.Dy()
+	}
+	r.OutputPages = len(pages)
+	r.DurationMillis = int64(time.Since(startTime) / time.Millisecond)
+}
+
+// ----------------------------------------------------------------------------
+
+type pageReports []*PageReport
+
+func (r pageReports) Len() int {
+	return len(r)
+}
+
+func (r pageReports) Less(i, j int) bool {
+	if r[i].Index != r[j].Index {
+		return r[i].Index < r[j].Index
+	}
+	return r[i].Filename < r[j].Filename
+}
+
+func (r pageReports) Swap(i, j int) {
+	r[i], r[j] = r[j], r[i]
+}
+
+// Report collects page reports.
+// It is safe for concurrent use.
+type Report struct {
+	mutex sync.Mutex
+	pages pageReports
+}
+
+// Add adds a page report.
+func (r *Report) Add(page *PageReport) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.pages = append(r.pages, page)
+}
+
+// Pages returns page reports sorted by page index.
+func (r *Report) Pages() []*PageReport {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	pages := make(pageReports, len(r.pages))
+	copy(pages, r.pages)
+	sort.Sort(pages)
+	return pages
+}
+
+// Write writes the report to a file.
+// File format is determined by the extension : '.json' or '.csv'
+func (r *Report) Write(filename string) error {
+	ext := lecio.GetExt(filename)
+	if ext != ".json" && ext != ".csv" {
+		return fmt.Errorf("unsupported report format : %v", ext)
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if ext == ".json" {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r.Pages())
+	}
+	return r.writeCsv(csv.NewWriter(file))
+}
+
+func (r *Report) writeCsv(writer *csv.Writer) error {
+	writer.Write([]string{
+		"filename", "index",
+		"inputWidth", "inputHeight", "outputWidth", "outputHeight", "outputPages",
+		"filters", "skewAngle", "orientation", "orientConfidence",
+		"cropLeft", "cropTop", "cropRight", "cropBottom",
+		"lineSpaceRanges", "threshold", "durationMillis", "error",
+	})
+
+	for _, page := range r.Pages() {
+		skewAngle := ""
+		if page.SkewAngle != nil {
+			skewAngle = strconv.FormatFloat(float64(*page.SkewAngle), 'f', 2, 32)
+		}
+		orientation, orientConfidence := "", ""
+		if page.Orientation != nil {
+			orientation = strconv.Itoa(*page.Orientation)
+		}
+		if page.OrientConfidence != nil {
+			orientConfidence = strconv.FormatFloat(float64(*page.OrientConfidence), 'f', 2, 32)
+		}
+		threshold := ""
+		if page.Threshold != nil {
+			threshold = strconv.Itoa(*page.Threshold)
+		}
+		crop := []string{"", "", "", ""}
+		if rect := page.CropRect; rect != nil {
+			crop = []string{
+				strconv.Itoa(rect.Left),
+				strconv.Itoa(rect.Top),
+				strconv.Itoa(rect.Right),
+				strconv.Itoa(rect.Bottom),
+			}
+		}
+
+		record := []string{
+			page.Filename,
+			strconv.Itoa(page.Index),
+			strconv.Itoa(page.InputWidth),
+			strconv.Itoa(page.InputHeight),
+			strconv.Itoa(page.OutputWidth),
+			strconv.Itoa(page.OutputHeight),
+			strconv.Itoa(page.OutputPages),
+			strings.Join(page.Filters, "|"),
+			skewAngle,
+			orientation,
+			orientConfidence,
+		}
+		record = append(record, crop...)
+		record = append(record,
+			strconv.Itoa(page.LineSpaceRanges),
+			threshold,
+			strconv.FormatInt(page.DurationMillis, 10),
+			page.Error)
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,116 @@
+package lecimg
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func runReportPipeline(t *testing.T) *Report {
+	img := CreateImage(200, 350, color.White)
+	FillRect(img, 50, 50, 150, 300, color.Black)
+
+	pipeline := NewPipeline(PassThroughOnError)
+	pipeline.AddFilter("autoCrop", NewAutoCropFilter(AutoCropOption{
+		Threshold: 128,
+		MinRatio:  1.0, MaxRatio: 3.0,
+		MaxWidthCropRate: 0.5, MaxHeightCropRate: 0.5,
+	}), nil)
+	pipeline.AddFilter("deskew", NewDeskewFilter(DeskewOption{}), nil)
+
+	for i := 1; i >= 0; i-- {
+		if _, err := pipeline.Run(img, "filename", i); err != nil {
+			t.Fatalf("pipeline failed : %v", err)
+		}
+	}
+	return pipeline.Report()
+}
+
+func TestReportPages(t *testing.T) {
+	pages := runReportPipeline(t).Pages()
+	if len(pages) != 2 {
+		t.Fatalf("page count mismatch. expected=2, actual=%v", len(pages))
+	}
+
+	page := pages[0]
+	if page.Index != 0 {
+		t.Errorf("pages are not sorted. actual index=%v", page.Index)
+	}
+	if page.InputWidth != 200 || page.InputHeight != 350 {
+		t.Errorf("input size mismatch. actual=%vx%v", page.InputWidth, page.InputHeight)
+	}
+	if page.OutputWidth != 100 || page.OutputHeight != 250 {
+		t.Errorf("output size mismatch. actual=%vx%v", page.OutputWidth, page.OutputHeight)
+	}
+	if len(page.Filters) != 2 {
+		t.Errorf("filters mismatch. actual=%v", page.Filters)
+	}
+	if page.SkewAngle == nil || *page.SkewAngle != 0 {
+		t.Errorf("skew angle mismatch. actual=%v", page.SkewAngle)
+	}
+	if page.CropRect == nil || *page.CropRect != (ReportRect{50, 50, 150, 300}) {
+		t.Errorf("crop rect mismatch. actual=%v", page.CropRect)
+	}
+}
+
+func TestReportPassThrough(t *testing.T) {
+	img := CreateImage(200, 350, color.White)
+	FillRect(img, 50, 50, 150, 300, color.Black)
+
+	pipeline := NewPipeline(PassThroughOnError)
+	pipeline.AddFilter("deskew", NewDeskewFilter(DeskewOption{}), nil)
+	pipeline.AddFilter("fail", failingFilter{failIndex: 0}, nil)
+	if _, err := pipeline.Run(img, "filename", 0); err != nil {
+		t.Fatalf("pipeline failed : %v", err)
+	}
+
+	page := pipeline.Report().Pages()[0]
+	if page.Error == "" || len(page.Filters) != 0 || page.SkewAngle != nil {
+		t.Errorf("facts of discarded stages should be reset. actual=%+v", page)
+	}
+	if page.InputWidth != 200 || page.OutputWidth != 200 {
+		t.Errorf("size mismatch. input=%v, output=%v", page.InputWidth, page.OutputWidth)
+	}
+}
+
+func TestReportWrite(t *testing.T) {
+	report := runReportPipeline(t)
+
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// json
+	jsonFilename := filepath.Join(dir, "report.json")
+	if err := report.Write(jsonFilename); err != nil {
+		t.Fatalf("failed to write json : %v", err)
+	}
+	data, _ := ioutil.ReadFile(jsonFilename)
+	var pages []PageReport
+	if err := json.Unmarshal(data, &pages); err != nil || len(pages) != 2 {
+		t.Errorf("invalid json report : %v", err)
+	}
+
+	// csv
+	csvFilename := filepath.Join(dir, "report.csv")
+	if err := report.Write(csvFilename); err != nil {
+		t.Fatalf("failed to write csv : %v", err)
+	}
+	file, _ := os.Open(csvFilename)
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil || len(records) != 3 {
+		t.Errorf("invalid csv report : %v", err)
+	}
+
+	// unsupported format
+	if err := report.Write(filepath.Join(dir, "report.txt")); err == nil {
+		t.Errorf("error expected for unsupported format")
+	}
+}
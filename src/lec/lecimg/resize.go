@@ -1,6 +1,7 @@
 package lecimg
 
 import (
+	"fmt"
 	"image"
 	"log"
 
@@ -51,21 +52,46 @@ func NewResizeFilter(option ResizeOption) *ResizeFilter {
 	return &ResizeFilter{option: option}
 }
 
-func (f ResizeFilter) Run(s *FilterSource) FilterResult {
+func init() {
+	RegisterFilter("resize", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewResizeOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewResizeFilter(*option), nil
+	})
+}
+
+func (f ResizeFilter) Run(s *FilterSource) (FilterResult, error) {
 	if !f.option.ScaleCover && s.index == 0 {
-		return ResizeResult{image: s.image, filename: s.filename, scaled: false}
+		return ResizeResult{image: s.image, filename: s.filename, scaled: false}, nil
 	}
 
 	bbox := s.image.Bounds()
 	width := int(f.option.WidthScale * float64(bbox.Dx()))
 	height := int(f.option.HeightScale * float64(bbox.Dy()))
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid resize dimension : %vx%v", width, height)
+	}
 	resizedImage := ResizeImage(s.image, width, height, false)
-	return ResizeResult{image: resizedImage, filename: s.filename, scaled: true}
+	return ResizeResult{image: resizedImage, filename: s.filename, scaled: true}, nil
 }
 
 // ----------------------------------------------------------------------------
 
+// FitImage resizes image to fit in given dimension while preserving aspect ratio.
+// It returns the image itself if its size already fits exactly.
+func FitImage(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	fitBounds := gift.New(gift.ResizeToFit(width, height, gift.LanczosResampling)).Bounds(bounds)
+	if fitBounds.Dx() == bounds.Dx() && fitBounds.Dy() == bounds.Dy() {
+		return src
+	}
+	return ResizeImage(src, width, height, true)
+}
+
 // ResizeImage resizes image to given dimension while preserving aspect ratio.
+// Gray images are resized to gray images.
 func ResizeImage(src image.Image, width, height int, keepAspectRatio bool) image.Image {
 	var g *gift.GIFT
 	if keepAspectRatio {
@@ -73,6 +99,12 @@ func ResizeImage(src image.Image, width, height int, keepAspectRatio bool) image
 	} else {
 		g = gift.New(gift.Resize(width, height, gift.LanczosResampling))
 	}
+	// keep single channel of gray images
+	if _, ok := src.(*image.Gray); ok {
+		dest := image.NewGray(g.Bounds(src.Bounds()))
+		g.Draw(dest, src)
+		return dest
+	}
 	dest := image.NewRGBA(g.Bounds(src.Bounds()))
 	g.Draw(dest, src)
 	return dest
@@ -63,3 +63,39 @@ func RotateImage(
 	gift.New(rotateFilter).Draw(dest, src)
 	return dest
 }
+
+// RotateImage90 rotates the image counter-clockwise by a multiple of 90 degrees
+// without interpolation. *image.Gray images stay *image.Gray.
+// Bounds of the returned image starts at (0, 0).
+func RotateImage90(src image.Image, angle int) image.Image {
+	angle = (angle%360 + 360) % 360
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	destWidth, destHeight := width, height
+	if angle == 90 || angle == 270 {
+		destWidth, destHeight = height, width
+	}
+	var dest draw.Image
+	if _, ok := src.(*image.Gray); ok {
+		dest = image.NewGray(image.Rect(0, 0, destWidth, destHeight))
+	} else {
+		dest = image.NewRGBA(image.Rect(0, 0, destWidth, destHeight))
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			destX, destY := x, y
+			switch angle {
+			case 90:
+				destX, destY = y, width-1-x
+			case 180:
+				destX, destY = width-1-x, height-1-y
+			case 270:
+				destX, destY = height-1-y, x
+			}
+			dest.Set(destX, destY, src.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return dest
+}
@@ -0,0 +1,217 @@
+package lecimg
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type pageTermKind int
+
+const (
+	indexTerm pageTermKind = iota
+	evenTerm
+	oddTerm
+	globTerm
+)
+
+// pageTerm is a term of page selector expression.
+type pageTerm struct {
+	kind    pageTermKind
+	from    int
+	to      int
+	openEnd bool
+	glob    string
+}
+
+var indexTermRegexp = regexp.MustCompile(`^(-?\d+)$`)
+var rangeTermRegexp = regexp.MustCompile(`^(-?\d+)-(-?\d+)?$`)
+
+func parsePageTerm(term string) (pageTerm, error) {
+	switch term {
+	case "even":
+		return pageTerm{kind: evenTerm}, nil
+	case "odd":
+		return pageTerm{kind: oddTerm}, nil
+	}
+
+	if m := indexTermRegexp.FindStringSubmatch(term); m != nil {
+		index, _ := strconv.Atoi(m[1])
+		return pageTerm{kind: indexTerm, from: index, to: index}, nil
+	}
+
+	if m := rangeTermRegexp.FindStringSubmatch(term); m != nil {
+		from, _ := strconv.Atoi(m[1])
+		if m[2] == "" {
+			return pageTerm{kind: indexTerm, from: from, openEnd: true}, nil
+		}
+		to, _ := strconv.Atoi(m[2])
+		return pageTerm{kind: indexTerm, from: from, to: to}, nil
+	}
+
+	if _, err := filepath.Match(term, ""); err != nil {
+		return pageTerm{}, fmt.Errorf("invalid page term : %v", term)
+	}
+	return pageTerm{kind: globTerm, glob: term}, nil
+}
+
+// resolveIndex converts negative index to index from the end.
+func resolveIndex(index, count int) (int, bool) {
+	if index >= 0 {
+		return index, true
+	}
+	if count <= 0 {
+		return 0, false
+	}
+	return count + index, true
+}
+
+func (t pageTerm) match(filename string, index, parity, count int) bool {
+	switch t.kind {
+	case evenTerm:
+		return parity >= 0 && parity%2 == 0
+	case oddTerm:
+		return parity >= 0 && parity%2 == 1
+	case globTerm:
+		matched, _ := filepath.Match(t.glob, filepath.Base(filename))
+		return matched
+	}
+
+	if index < 0 {
+		return false
+	}
+	from, ok := resolveIndex(t.from, count)
+	if !ok {
+		return false
+	}
+	if t.openEnd {
+		return from <= index
+	}
+	to, ok := resolveIndex(t.to, count)
+	if !ok {
+		return false
+	}
+	return from <= index && index <= to
+}
+
+// PageSelector selects pages by index or filename.
+//
+// Selector expression is a comma separated list of terms :
+//
+//	"3"       : page index (0-based)
+//	"-1"      : page index from the end (-1 is the last page)
+//	"2-10"    : page index range (inclusive). "5-" means from 5 to the last page.
+//	"even"    : even page index
+//	"odd"     : odd page index
+//	"cover*"  : filename glob
+//
+// A term prefixed with '!' excludes matched pages.
+// If there is no including term, all pages except excluded ones are selected.
+type PageSelector struct {
+	expr     string
+	includes []pageTerm
+	excludes []pageTerm
+}
+
+// NewPageSelector creates an instance of PageSelector from expression.
+// Empty expression returns nil which selects all pages.
+func NewPageSelector(expr string) (*PageSelector, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, nil
+	}
+
+	selector := PageSelector{expr: expr}
+	for _, term := range strings.Split(expr, ",") {
+		term = strings.TrimSpace(term)
+		exclude := strings.HasPrefix(term, "!")
+		if exclude {
+			term = strings.TrimSpace(term[1:])
+		}
+		if term == "" {
+			return nil, fmt.Errorf("empty page term : %v", expr)
+		}
+
+		t, err := parsePageTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		if exclude {
+			selector.excludes = append(selector.excludes, t)
+		} else {
+			selector.includes = append(selector.includes, t)
+		}
+	}
+	return &selector, nil
+}
+
+// PageSelectorExpr returns the selector expression of a "pages" value of a config file.
+// Items of a list such as [1, 3-5] are joined with commas.
+func PageSelectorExpr(value interface{}) (string, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return pageTermExpr(value)
+	}
+
+	terms := make([]string, len(items))
+	for i, item := range items {
+		term, err := pageTermExpr(item)
+		if err != nil {
+			return "", err
+		}
+		terms[i] = term
+	}
+	return strings.Join(terms, ","), nil
+}
+
+// pageTermExpr returns the expression of a scalar value.
+func pageTermExpr(value interface{}) (string, error) {
+	switch value.(type) {
+	case nil:
+		return "", nil
+	case string, int, int64, uint64, float64:
+		return fmt.Sprint(value), nil
+	}
+	return "", fmt.Errorf("invalid pages : %v", value)
+}
+
+// Match checks if the page is selected.
+// index is -1 if page index is unknown, count is 0 if page count is unknown.
+// nil selector selects all pages.
+func (s *PageSelector) Match(filename string, index, count int) bool {
+	return s.matchPage(filename, index, index, count)
+}
+
+// matchPage checks if the page is selected like Match.
+// "even" and "odd" terms match by parity instead of index,
+// so that pages split from one source page alternate.
+func (s *PageSelector) matchPage(filename string, index, parity, count int) bool {
+	if s == nil {
+		return true
+	}
+
+	for _, t := range s.excludes {
+		if t.match(filename, index, parity, count) {
+			return false
+		}
+	}
+
+	if len(s.includes) == 0 {
+		return true
+	}
+	for _, t := range s.includes {
+		if t.match(filename, index, parity, count) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PageSelector) String() string {
+	if s == nil {
+		return ""
+	}
+	return s.expr
+}
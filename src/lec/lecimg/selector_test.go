@@ -0,0 +1,113 @@
+package lecimg
+
+import (
+	"testing"
+)
+
+func testPageSelector(t *testing.T, expr string, count int, expected []int) {
+	selector, err := NewPageSelector(expr)
+	if err != nil {
+		t.Fatalf("failed to parse %q : %v", expr, err)
+	}
+
+	var selected []int
+	for i := 0; i < count; i++ {
+		if selector.Match("page.jpg", i, count) {
+			selected = append(selected, i)
+		}
+	}
+
+	if len(selected) != len(expected) {
+		t.Fatalf("%q : selected mismatch. expected=%v, actual=%v", expr, expected, selected)
+	}
+	for i := range expected {
+		if selected[i] != expected[i] {
+			t.Fatalf("%q : selected mismatch. expected=%v, actual=%v", expr, expected, selected)
+		}
+	}
+}
+
+func TestPageSelectorIndex(t *testing.T) {
+	testPageSelector(t, "", 4, []int{0, 1, 2, 3})
+	testPageSelector(t, "0", 4, []int{0})
+	testPageSelector(t, "-1", 4, []int{3})
+	testPageSelector(t, "1-2", 4, []int{1, 2})
+	testPageSelector(t, "2-", 4, []int{2, 3})
+	testPageSelector(t, "1--2", 5, []int{1, 2, 3})
+	testPageSelector(t, "0, -1", 4, []int{0, 3})
+}
+
+func TestPageSelectorParity(t *testing.T) {
+	testPageSelector(t, "even", 5, []int{0, 2, 4})
+	testPageSelector(t, "odd", 5, []int{1, 3})
+}
+
+func TestPageSelectorExclude(t *testing.T) {
+	testPageSelector(t, "!0", 4, []int{1, 2, 3})
+	testPageSelector(t, "!0,!-1", 4, []int{1, 2})
+	testPageSelector(t, "even,!0", 5, []int{2, 4})
+}
+
+func TestPageSelectorGlob(t *testing.T) {
+	selector, err := NewPageSelector("!cover*, !plate_??.jpg")
+	if err != nil {
+		t.Fatalf("failed to parse : %v", err)
+	}
+
+	for filename, expected := range map[string]bool{
+		"cover.jpg":       false,
+		"dir/cover01.png": false,
+		"plate_01.jpg":    false,
+		"plate_001.jpg":   true,
+		"page001.jpg":     true,
+	} {
+		if selector.Match(filename, -1, 0) != expected {
+			t.Errorf("match mismatch. filename=%v, expected=%v", filename, expected)
+		}
+	}
+}
+
+func TestPageSelectorUnknownIndex(t *testing.T) {
+	selector, _ := NewPageSelector("0,odd")
+	if selector.Match("page.jpg", -1, 0) {
+		t.Errorf("index term should not match unknown index")
+	}
+
+	selector, _ = NewPageSelector("-1")
+	if selector.Match("page.jpg", 3, 0) {
+		t.Errorf("negative index should not match unknown page count")
+	}
+}
+
+func TestPageSelectorInvalid(t *testing.T) {
+	for _, expr := range []string{"1,,2", "!", "[a-"} {
+		if _, err := NewPageSelector(expr); err == nil {
+			t.Errorf("error expected. expr=%q", expr)
+		}
+	}
+}
+
+func TestPageSelectorExpr(t *testing.T) {
+	for _, c := range []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, ""},
+		{"!0, odd", "!0, odd"},
+		{-1, "-1"},
+		{[]interface{}{1, "3-5", "!cover*"}, "1,3-5,!cover*"},
+	} {
+		if expr, err := PageSelectorExpr(c.value); err != nil || expr != c.expected {
+			t.Errorf("%v : expression mismatch. expected=%q, actual=%q, err=%v", c.value, c.expected, expr, err)
+		}
+	}
+
+	for _, value := range []interface{}{
+		map[string]interface{}{"from": 1},
+		[]interface{}{1, []interface{}{2}},
+	} {
+		if _, err := PageSelectorExpr(value); err == nil {
+			t.Errorf("%v : error expected", value)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package lecimg
+
+import (
+	"fmt"
+	"image"
+	"log"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// default values of SplitColumnsOption
+const (
+	defaultColumnsMinGutterRate      = 0.02
+	defaultColumnsMinColumnWidthRate = 0.15
+	defaultColumnsGutterDotRate      = 0.01
+	defaultColumnsMinEmptyRate       = 0.5
+)
+
+type SplitColumnsOption struct {
+	Order              string  // "ltr"(default) : left column first, "rtl" : right column first
+	Threshold          uint8   // min brightness of space (0~255)
+	AutoThreshold      bool    // selects Threshold of each page by Otsu's method ("threshold: auto")
+	LockThreshold      bool    // uses one auto threshold for the book
+	MinGutterRate      float32 // min gutter width as rate of the text block width (default: 0.02)
+	MinColumnWidthRate float32 // min column width as rate of the text block width (default: 0.15)
+	MaxGutterDotRate   float32 // max rate of dark dots in a gutter column of a line range (default: 0.01)
+	MinEmptyRate       float32 // min rate of text height where a gutter is empty (default: 0.5)
+	EmptyLineThreshold float64 // max dot count of empty lines. rate of the width if less than 1
+}
+
+func NewSplitColumnsOption(m map[string]interface{}) (*SplitColumnsOption, error) {
+	option := SplitColumnsOption{}
+
+	m, auto := parseAutoThreshold(m)
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+	option.AutoThreshold = option.AutoThreshold || auto
+
+	if err := validatePageOrder(option.Order); err != nil {
+		return nil, err
+	}
+	if option.MinGutterRate < 0 || option.MinGutterRate >= 0.5 ||
+		option.MinColumnWidthRate < 0 || option.MinColumnWidthRate >= 0.5 {
+		return nil, fmt.Errorf("invalid minGutterRate or minColumnWidthRate : minGutterRate=%v, minColumnWidthRate=%v",
+			option.MinGutterRate, option.MinColumnWidthRate)
+	}
+	if option.MinEmptyRate < 0 || option.MinEmptyRate > 1 {
+		return nil, fmt.Errorf("invalid minEmptyRate : %v", option.MinEmptyRate)
+	}
+
+	return &option, nil
+}
+
+type SplitColumnsResult struct {
+	thresholdResult
+	images  []image.Image
+	columns int
+}
+
+func (r SplitColumnsResult) Img() image.Image {
+	return r.images[0]
+}
+
+// Implements MultiPageResult.Imgs()
+func (r SplitColumnsResult) Imgs() []image.Image {
+	return r.images
+}
+
+func (r SplitColumnsResult) Log() {
+	r.logThreshold()
+	if r.columns > 1 {
+		log.Printf("[COLUMNS] %v : %v columns, %v pages\n", r.filename, r.columns, len(r.images))
+	}
+}
+
+func (r SplitColumnsResult) Report(report *PageReport) {
+	r.reportThreshold(report)
+}
+
+// ----------------------------------------------------------------------------
+
+// SplitColumnsFilter splits multi-column pages such as papers and magazines
+// into a page per column so that the text stays readable on small screens.
+// Full-width headings and figures are kept whole on their own pages.
+type SplitColumnsFilter struct {
+	autoThresholdFilter
+	option SplitColumnsOption
+}
+
+func NewSplitColumnsFilter(option SplitColumnsOption) *SplitColumnsFilter {
+	if option.Order == "" {
+		option.Order = PageOrderLTR
+	}
+	if option.MinGutterRate == 0 {
+		option.MinGutterRate = defaultColumnsMinGutterRate
+	}
+	if option.MinColumnWidthRate == 0 {
+		option.MinColumnWidthRate = defaultColumnsMinColumnWidthRate
+	}
+	if option.MaxGutterDotRate == 0 {
+		option.MaxGutterDotRate = defaultColumnsGutterDotRate
+	}
+	if option.MinEmptyRate == 0 {
+		option.MinEmptyRate = defaultColumnsMinEmptyRate
+	}
+
+	return &SplitColumnsFilter{
+		option:              option,
+		autoThresholdFilter: autoThresholdFilter{newAutoThreshold(option.AutoThreshold, option.LockThreshold)},
+	}
+}
+
+func init() {
+	RegisterFilter("splitColumns", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewSplitColumnsOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewSplitColumnsFilter(*option), nil
+	})
+}
+
+// Implements Filter.Run()
+func (f SplitColumnsFilter) Run(s *FilterSource) (FilterResult, error) {
+	if f.threshold.enabled() {
+		f.option.Threshold = f.threshold.get(s.image)
+	}
+	threshold := thresholdResult{s.filename, f.threshold.enabled(), f.option.Threshold}
+
+	src := cropImage(s.image, s.image.Bounds())
+	sections, columns := f.findSections(src)
+	if columns < 2 {
+		return SplitColumnsResult{threshold, []image.Image{s.image}, 1}, nil
+	}
+
+	var images []image.Image
+	for _, section := range sections {
+		for _, column := range section.columns {
+			rect := image.Rect(column.start, section.start, column.end, section.end)
+			if len(section.columns) == 1 {
+				images = append(images, cropImage(src, rect))
+				continue
+			}
+			images = append(images, f.splitColumn(src, rect, s.deviceWidth, s.deviceHeight)...)
+		}
+	}
+	return SplitColumnsResult{threshold, images, columns}, nil
+}
+
+// span is a range of x or y from start to end (exclusive).
+type span struct {
+	start, end int
+}
+
+// columnSection is a band of the page from start to end (exclusive) in y
+// which has the same columns. Full-width sections have one column.
+type columnSection struct {
+	start, end int
+	columns    []span
+}
+
+// findSections splits the page into full-width and multi-column sections
+// and returns them in reading order with the max number of columns.
+//
+// Gutters are runs of columns in the text block which are empty in most of
+// the text height. Line ranges of the whole width in which every gutter is
+// empty are multi-column, others such as headings and figures are full-width.
+func (f SplitColumnsFilter) findSections(src image.Image) ([]columnSection, int) {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	thresholdSum := uint32(f.option.Threshold) * 256 * 3
+	dark := make([]bool, width*height)
+	left, right := width, -1
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if r, g, b, _ := src.At(x, y).RGBA(); r+g+b < thresholdSum {
+				dark[y*width+x] = true
+				left, right = Min(left, x), Max(right, x)
+			}
+		}
+	}
+	if right < 0 {
+		return nil, 0
+	}
+	blockWidth := right + 1 - left
+
+	// text line ranges and their column profiles
+	var texts []span
+	for _, r := range findLineRanges(src, uint32(f.option.Threshold), f.option.EmptyLineThreshold) {
+		if !r.emptyLine {
+			texts = append(texts, span{r.start, r.end + 1})
+		}
+	}
+	if len(texts) == 0 {
+		return nil, 1
+	}
+	emptyColumns := func(text span) []bool {
+		maxDotCount := int(float32(text.end-text.start) * f.option.MaxGutterDotRate)
+		empty := make([]bool, width)
+		for x := left; x <= right; x++ {
+			count := 0
+			for y := text.start; y < text.end && count <= maxDotCount; y++ {
+				if dark[y*width+x] {
+					count++
+				}
+			}
+			empty[x] = count <= maxDotCount
+		}
+		return empty
+	}
+	empties := make([][]bool, len(texts))
+	emptyHeights := make([]int, width)
+	textHeight := 0
+	for i, text := range texts {
+		empties[i] = emptyColumns(text)
+		for x := left; x <= right; x++ {
+			if empties[i][x] {
+				emptyHeights[x] += text.end - text.start
+			}
+		}
+		textHeight += text.end - text.start
+	}
+
+	// gutters inside the text block
+	minGutter := Max(1, int(float32(blockWidth)*f.option.MinGutterRate))
+	minColumn := Max(1, int(float32(blockWidth)*f.option.MinColumnWidthRate))
+	var gutters []span
+	start := -1
+	for x := left; x <= right+1; x++ {
+		isGutter := x <= right && float32(emptyHeights[x]) >= float32(textHeight)*f.option.MinEmptyRate
+		if isGutter && start < 0 {
+			start = x
+		} else if !isGutter && start >= 0 {
+			columnStart := left
+			if len(gutters) > 0 {
+				columnStart = gutters[len(gutters)-1].end
+			}
+			if x-start >= minGutter && start-columnStart >= minColumn && right+1-x >= minColumn {
+				gutters = append(gutters, span{start, x})
+			}
+			start = -1
+		}
+	}
+	if len(gutters) == 0 {
+		return nil, 1
+	}
+
+	columns := make([]span, 0, len(gutters)+1)
+	columnStart := left
+	for _, gutter := range gutters {
+		columns = append(columns, span{columnStart, gutter.start})
+		columnStart = gutter.end
+	}
+	columns = append(columns, span{columnStart, right + 1})
+	if f.option.Order == PageOrderRTL {
+		for i, j := 0, len(columns)-1; i < j; i, j = i+1, j-1 {
+			columns[i], columns[j] = columns[j], columns[i]
+		}
+	}
+	fullWidth := []span{{left, right + 1}}
+
+	// sections of adjacent line ranges of the same kind.
+	// the empty space between sections belongs to the upper section.
+	var sections []columnSection
+	for i, text := range texts {
+		multi := true
+		for _, gutter := range gutters {
+			for x := gutter.start; x < gutter.end && multi; x++ {
+				multi = empties[i][x]
+			}
+		}
+
+		if n := len(sections); n > 0 && (len(sections[n-1].columns) > 1) == multi {
+			sections[n-1].end = text.end
+			continue
+		}
+		if n := len(sections); n > 0 {
+			sections[n-1].end = text.start
+		}
+		section := columnSection{start: text.start, end: text.end, columns: fullWidth}
+		if multi {
+			section.columns = columns
+		}
+		sections = append(sections, section)
+	}
+	if len(sections) == 0 {
+		return nil, 1
+	}
+	sections[0].start = 0
+	sections[len(sections)-1].end = height
+
+	return sections, len(columns)
+}
+
+// splitColumn crops the column into pages which fit the device aspect ratio
+// when the column is scaled to the device width. Pages are cut at line gaps,
+// or at the page height if a text line is taller than the page.
+// The column is not cut if the device size is unknown.
+func (f SplitColumnsFilter) splitColumn(src image.Image, rect image.Rectangle, deviceWidth, deviceHeight int) []image.Image {
+	column := cropImage(src, rect)
+	if deviceWidth <= 0 || deviceHeight <= 0 {
+		return []image.Image{column}
+	}
+	width, height := rect.Dx(), rect.Dy()
+	pageHeight := Max(1, width*deviceHeight/deviceWidth)
+
+	// centres of line gaps are the cut candidates
+	var cuts []int
+	for _, r := range findLineRanges(column, uint32(f.option.Threshold), f.option.EmptyLineThreshold) {
+		if r.emptyLine && r.start > 0 && r.end < height-1 {
+			cuts = append(cuts, (r.start+r.end+1)/2)
+		}
+	}
+	cuts = append(cuts, height)
+
+	var pages []image.Image
+	top := 0
+	for top < height {
+		bottom := Min(height, top+pageHeight)
+		if bottom < height {
+			best := -1
+			for _, cut := range cuts {
+				if cut > top && cut <= bottom {
+					best = cut
+				}
+			}
+			if best > 0 {
+				bottom = best
+			}
+		}
+		pages = append(pages, cropImage(column, image.Rect(0, top, width, bottom)))
+		top = bottom
+	}
+	return pages
+}
@@ -0,0 +1,90 @@
+package lecimg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// createColumnsPage draws a heading, two columns, a full-width figure and two columns again.
+func createColumnsPage() *image.RGBA {
+	img := CreateImage(600, 800, color.White)
+	FillRect(img, 50, 40, 550, 70, color.Black) // heading
+	drawColumnLines := func(top, bottom int) {
+		for y := top; y+8 <= bottom; y += 16 {
+			FillRect(img, 50, y, 290, y+8, color.Black)
+			FillRect(img, 310, y+6, 550, y+14, color.Black)
+		}
+	}
+	drawColumnLines(100, 400)
+	FillRect(img, 50, 430, 550, 500, color.Black) // figure
+	drawColumnLines(530, 760)
+	return img
+}
+
+func TestSplitColumns(t *testing.T) {
+	result := runTestFilter(t, NewSplitColumnsFilter(SplitColumnsOption{Threshold: 128}), createColumnsPage()).(SplitColumnsResult)
+	if result.columns != 2 || len(result.Imgs()) != 6 {
+		t.Fatalf("page count mismatch. columns=%v, pages=%v", result.columns, len(result.Imgs()))
+	}
+
+	// heading, left, right, figure, left, right
+	expectedWidths := []int{500, 240, 240, 500, 240, 240}
+	for i, img := range result.Imgs() {
+		if width := img.Bounds().Dx(); width != expectedWidths[i] {
+			t.Errorf("page %v width mismatch. expected=%v, actual=%v", i, expectedWidths[i], width)
+		}
+	}
+	// lines of the right column start 6 dots lower than the left one
+	left, right := result.Imgs()[1], result.Imgs()[2]
+	if !isDark(left, 0, 0) || isDark(right, 0, 0) || !isDark(right, 0, 6) {
+		t.Errorf("left column should be followed by right column")
+	}
+
+	result = runTestFilter(t, NewSplitColumnsFilter(SplitColumnsOption{Threshold: 128, Order: PageOrderRTL}), createColumnsPage()).(SplitColumnsResult)
+	if len(result.Imgs()) != 6 || isDark(result.Imgs()[1], 0, 0) {
+		t.Errorf("right column should be first in rtl order")
+	}
+}
+
+func TestSplitColumnsDeviceHeight(t *testing.T) {
+	s := NewFilterSource(createColumnsPage(), "filename", 0)
+	s.deviceWidth, s.deviceHeight = 600, 400
+
+	result := runTestFilterSource(t, NewSplitColumnsFilter(SplitColumnsOption{Threshold: 128}), s).(SplitColumnsResult)
+	pages := result.Imgs()
+	if len(pages) <= 6 {
+		t.Fatalf("tall columns should be split. pages=%v", len(pages))
+	}
+	for i, page := range pages {
+		bounds := page.Bounds()
+		if bounds.Dx() == 240 && bounds.Dy() > 160 {
+			t.Errorf("page %v is taller than the device. actual=%v", i, bounds)
+		}
+		// pages are cut at line gaps
+		if bounds.Dx() == 240 && (isDark(page, 0, 0) && isDark(page, 0, bounds.Dy()-1)) {
+			t.Errorf("page %v is cut in a text line", i)
+		}
+	}
+}
+
+func TestSplitColumnsSingleColumn(t *testing.T) {
+	img := CreateImage(600, 800, color.White)
+	for y := 100; y < 700; y += 16 {
+		FillRect(img, 50, y, 550, y+8, color.Black)
+	}
+	result := runTestFilter(t, NewSplitColumnsFilter(SplitColumnsOption{Threshold: 128}), img).(SplitColumnsResult)
+	if len(result.Imgs()) != 1 || result.Img() != image.Image(img) {
+		t.Errorf("single column page should be left alone. pages=%v", len(result.Imgs()))
+	}
+}
+
+func TestSplitColumnsSpeck(t *testing.T) {
+	// the speck is an empty line, so the page has no text lines
+	img := CreateImage(200, 300, color.White)
+	FillRect(img, 100, 150, 104, 152, color.Black)
+	result := runTestFilter(t, NewSplitColumnsFilter(SplitColumnsOption{Threshold: 128, EmptyLineThreshold: 10}), img).(SplitColumnsResult)
+	if len(result.Imgs()) != 1 || result.Img() != image.Image(img) {
+		t.Errorf("page without text lines should be left alone. pages=%v", len(result.Imgs()))
+	}
+}
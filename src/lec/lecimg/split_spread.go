@@ -0,0 +1,218 @@
+package lecimg
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// page orders of split pages
+const (
+	PageOrderLTR = "ltr"
+	PageOrderRTL = "rtl"
+)
+
+func validatePageOrder(order string) error {
+	switch order {
+	case "", PageOrderLTR, PageOrderRTL:
+		return nil
+	}
+	return fmt.Errorf("invalid order : %v", order)
+}
+
+// default values of SplitSpreadOption
+const (
+	defaultSpreadMinAspectRatio = 1.0
+	defaultSpreadSearchRange    = 0.1
+	defaultSpreadGutterDotRate  = 0.01
+)
+
+type SplitSpreadOption struct {
+	Order            string  // "ltr"(default) : left page first, "rtl" : right page first
+	Threshold        uint8   // min brightness of space (0~255)
+	AutoThreshold    bool    // selects Threshold of each page by Otsu's method ("threshold: auto")
+	LockThreshold    bool    // uses one auto threshold for the book
+	MinAspectRatio   float32 // splits only if width / height >= value (default: 1.0)
+	SearchRange      float32 // rate of width on each side of the centre to search the gutter (default: 0.1)
+	MaxGutterDotRate float32 // max rate of dark dots in a gutter column (default: 0.01)
+	ForceCenter      bool    // always splits at the centre
+}
+
+func NewSplitSpreadOption(m map[string]interface{}) (*SplitSpreadOption, error) {
+	option := SplitSpreadOption{}
+
+	m, auto := parseAutoThreshold(m)
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+	option.AutoThreshold = option.AutoThreshold || auto
+
+	if err := validatePageOrder(option.Order); err != nil {
+		return nil, err
+	}
+	if option.SearchRange < 0 || option.SearchRange >= 0.5 {
+		return nil, fmt.Errorf("invalid searchRange : %v", option.SearchRange)
+	}
+
+	return &option, nil
+}
+
+type SplitSpreadResult struct {
+	thresholdResult
+	images   []image.Image
+	gutter   int
+	centered bool
+}
+
+func (r SplitSpreadResult) Img() image.Image {
+	return r.images[0]
+}
+
+// Implements MultiPageResult.Imgs()
+func (r SplitSpreadResult) Imgs() []image.Image {
+	return r.images
+}
+
+func (r SplitSpreadResult) Log() {
+	r.logThreshold()
+	if len(r.images) < 2 {
+		return
+	}
+	if r.centered {
+		log.Printf("[SPLIT] %v : %v (centre)\n", r.filename, r.gutter)
+	} else {
+		log.Printf("[SPLIT] %v : %v\n", r.filename, r.gutter)
+	}
+}
+
+func (r SplitSpreadResult) Report(report *PageReport) {
+	r.reportThreshold(report)
+}
+
+// ----------------------------------------------------------------------------
+
+// SplitSpreadFilter splits a scan of two facing pages into two pages.
+type SplitSpreadFilter struct {
+	autoThresholdFilter
+	option SplitSpreadOption
+}
+
+func NewSplitSpreadFilter(option SplitSpreadOption) *SplitSpreadFilter {
+	if option.Order == "" {
+		option.Order = PageOrderLTR
+	}
+	if option.MinAspectRatio == 0 {
+		option.MinAspectRatio = defaultSpreadMinAspectRatio
+	}
+	if option.SearchRange == 0 {
+		option.SearchRange = defaultSpreadSearchRange
+	}
+	if option.MaxGutterDotRate == 0 {
+		option.MaxGutterDotRate = defaultSpreadGutterDotRate
+	}
+
+	return &SplitSpreadFilter{
+		option:              option,
+		autoThresholdFilter: autoThresholdFilter{newAutoThreshold(option.AutoThreshold, option.LockThreshold)},
+	}
+}
+
+func init() {
+	RegisterFilter("splitSpread", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewSplitSpreadOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewSplitSpreadFilter(*option), nil
+	})
+}
+
+// Implements Filter.Run()
+func (f SplitSpreadFilter) Run(s *FilterSource) (FilterResult, error) {
+	bounds := s.image.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if f.threshold.enabled() {
+		f.option.Threshold = f.threshold.get(s.image)
+	}
+	threshold := thresholdResult{s.filename, f.threshold.enabled(), f.option.Threshold}
+
+	if float32(width) < float32(height)*f.option.MinAspectRatio || width < 2 {
+		return SplitSpreadResult{threshold, []image.Image{s.image}, 0, false}, nil
+	}
+
+	gutter, found := f.findGutter(s.image)
+	left := cropImage(s.image, image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+gutter, bounds.Max.Y))
+	right := cropImage(s.image, image.Rect(bounds.Min.X+gutter, bounds.Min.Y, bounds.Max.X, bounds.Max.Y))
+
+	images := []image.Image{left, right}
+	if f.option.Order == PageOrderRTL {
+		images = []image.Image{right, left}
+	}
+	return SplitSpreadResult{threshold, images, gutter, !found}, nil
+}
+
+// findGutter returns the x offset of the gutter from the left edge.
+// It searches the widest run of columns with few dark dots near the centre
+// from the vertical projection profile.
+// It returns the centre and false if there is no such column.
+func (f SplitSpreadFilter) findGutter(src image.Image) (int, bool) {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	center := width / 2
+	if f.option.ForceCenter {
+		return center, false
+	}
+
+	searchWidth := int(float32(width) * f.option.SearchRange)
+	from, to := Max(1, center-searchWidth), Min(width-1, center+searchWidth)
+	maxDotCount := int(float32(height) * f.option.MaxGutterDotRate)
+
+	thresholdSum := uint32(f.option.Threshold) * 256 * 3
+	bestStart, bestLength := 0, 0
+	start := -1
+	for x := from; x <= to; x++ {
+		empty := false
+		if x < to {
+			count := 0
+			for y := 0; y < height && count <= maxDotCount; y++ {
+				if r, g, b, _ := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA(); r+g+b < thresholdSum {
+					count++
+				}
+			}
+			empty = count <= maxDotCount
+		}
+
+		if empty && start < 0 {
+			start = x
+		} else if !empty && start >= 0 {
+			if length := x - start; length > bestLength {
+				bestStart, bestLength = start, length
+			}
+			start = -1
+		}
+	}
+
+	if bestLength == 0 {
+		return center, false
+	}
+	return bestStart + bestLength/2, true
+}
+
+// cropImage copies the rectangle of the image into a new image
+// whose bounds start at (0, 0).
+func cropImage(src image.Image, rect image.Rectangle) image.Image {
+	rect = rect.Intersect(src.Bounds())
+	if gray, ok := src.(*image.Gray); ok {
+		dest := image.NewGray(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+		draw.Draw(dest, dest.Bounds(), gray, rect.Min, draw.Src)
+		return dest
+	}
+	dest := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dest, dest.Bounds(), src, rect.Min, draw.Src)
+	return dest
+}
@@ -0,0 +1,103 @@
+package lecimg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func newSpreadPage() *image.RGBA {
+	img := CreateImage(400, 300, color.White)
+	FillRect(img, 20, 20, 150, 280, color.Black)
+	FillRect(img, 210, 20, 380, 280, color.Gray{100})
+	return img
+}
+
+func TestSplitSpreadGutter(t *testing.T) {
+	result := runTestFilter(t, NewSplitSpreadFilter(SplitSpreadOption{Threshold: 128}), newSpreadPage()).(SplitSpreadResult)
+	if result.centered || result.gutter < 160 || result.gutter >= 210 {
+		t.Errorf("gutter mismatch. actual=%v, centered=%v", result.gutter, result.centered)
+	}
+
+	pages := result.Imgs()
+	if len(pages) != 2 {
+		t.Fatalf("page count mismatch. actual=%v", len(pages))
+	}
+	if pages[0].Bounds().Dx()+pages[1].Bounds().Dx() != 400 {
+		t.Errorf("page width mismatch. actual=%v, %v", pages[0].Bounds(), pages[1].Bounds())
+	}
+	if r, _, _, _ := pages[0].At(30, 30).RGBA(); r != 0 {
+		t.Errorf("left page should be first")
+	}
+}
+
+func TestSplitSpreadRTL(t *testing.T) {
+	pages := runTestFilter(t, NewSplitSpreadFilter(SplitSpreadOption{Threshold: 128, Order: PageOrderRTL}), newSpreadPage()).(SplitSpreadResult).Imgs()
+	if r, _, _, _ := pages[1].At(30, 30).RGBA(); r != 0 {
+		t.Errorf("left page should be last")
+	}
+}
+
+func TestSplitSpreadCenterFallback(t *testing.T) {
+	img := CreateImage(400, 300, color.White)
+	FillRect(img, 20, 20, 380, 280, color.Black)
+
+	result := runTestFilter(t, NewSplitSpreadFilter(SplitSpreadOption{Threshold: 128}), img).(SplitSpreadResult)
+	if !result.centered || result.gutter != 200 {
+		t.Errorf("centre fallback expected. actual=%v", result.gutter)
+	}
+}
+
+func TestSplitSpreadPortrait(t *testing.T) {
+	result := runTestFilter(t, NewSplitSpreadFilter(SplitSpreadOption{Threshold: 128}), CreateImage(300, 400, color.White)).(SplitSpreadResult)
+	if len(result.Imgs()) != 1 {
+		t.Errorf("portrait page should not be split")
+	}
+}
+
+func TestPipelineMultiPage(t *testing.T) {
+	pipeline := NewPipeline(AbortOnError)
+	pipeline.AddFilter("splitSpread", NewSplitSpreadFilter(SplitSpreadOption{Threshold: 128}), nil)
+	pipeline.AddFilter("resize", NewResizeFilter(ResizeOption{WidthScale: 0.5, HeightScale: 0.5, ScaleCover: true}), nil)
+
+	pages, err := pipeline.RunPages(newSpreadPage(), "filename", 0)
+	if err != nil {
+		t.Fatalf("pipeline failed : %v", err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("page count mismatch. actual=%v", len(pages))
+	}
+	for _, page := range pages {
+		if page.Bounds().Dy() != 150 {
+			t.Errorf("following filter should be applied to every page. actual=%v", page.Bounds())
+		}
+	}
+
+	if report := pipeline.Report().Pages()[0]; report.OutputPages != 2 {
+		t.Errorf("output pages mismatch. actual=%v", report.OutputPages)
+	}
+}
+
+func TestPipelineSplitPageSource(t *testing.T) {
+	var sources []FilterSource
+	selector, _ := NewPageSelector("odd")
+
+	pipeline := NewPipeline(AbortOnError)
+	pipeline.AddFilter("splitSpread", NewSplitSpreadFilter(SplitSpreadOption{Threshold: 128}), nil)
+	pipeline.AddFilter("record", recordingFilter{&sources}, selector)
+	pipeline.SetPageCount(3)
+
+	pages, err := pipeline.RunPages(newSpreadPage(), "p01.jpg", 2)
+	if err != nil || len(pages) != 2 {
+		t.Fatalf("pipeline failed : pages=%v, err=%v", len(pages), err)
+	}
+
+	// only the right page is odd, whatever the index of the spread
+	if len(sources) != 1 {
+		t.Fatalf("selected page count mismatch. actual=%v", len(sources))
+	}
+	s := sources[0]
+	if s.filename != "p01-002.jpg" || s.index != 2 || s.subIndex != 1 || s.parityIndex() != 1 {
+		t.Errorf("split page source mismatch. filename=%v, index=%v, subIndex=%v", s.filename, s.index, s.subIndex)
+	}
+}
@@ -0,0 +1,201 @@
+package lecimg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// default values of SplitTallOption
+const (
+	defaultTallRate        = 1.2
+	defaultTallMinPageRate = 0.5
+)
+
+type SplitTallOption struct {
+	Threshold          uint8   // min brightness of space (0~255)
+	AutoThreshold      bool    // selects Threshold of each page by Otsu's method ("threshold: auto")
+	LockThreshold      bool    // uses one auto threshold for the book
+	Width              int     // width of the page aspect. the device width is used if 0
+	Height             int     // height of the page aspect. the device height is used if 0
+	TallRate           float32 // splits pages taller than the page aspect times value (default: 1.2)
+	MinPageRate        float32 // min height of cut pages as rate of the page height (default: 0.5)
+	Overlap            float64 // band repeated at the top of the next page in pixels. rate of the page height if less than 1
+	EmptyLineThreshold float64 // max dot count of empty lines. rate of the width if less than 1
+}
+
+func NewSplitTallOption(m map[string]interface{}) (*SplitTallOption, error) {
+	option := SplitTallOption{}
+
+	m, auto := parseAutoThreshold(m)
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+	option.AutoThreshold = option.AutoThreshold || auto
+
+	if option.Width < 0 || option.Height < 0 || option.TallRate < 0 {
+		return nil, fmt.Errorf("invalid page size or tallRate : width=%v, height=%v, tallRate=%v",
+			option.Width, option.Height, option.TallRate)
+	}
+	if option.MinPageRate < 0 || option.MinPageRate > 1 || option.Overlap < 0 {
+		return nil, fmt.Errorf("invalid minPageRate or overlap : minPageRate=%v, overlap=%v",
+			option.MinPageRate, option.Overlap)
+	}
+
+	return &option, nil
+}
+
+type SplitTallResult struct {
+	thresholdResult
+	images []image.Image
+}
+
+func (r SplitTallResult) Img() image.Image {
+	return r.images[0]
+}
+
+// Implements MultiPageResult.Imgs()
+func (r SplitTallResult) Imgs() []image.Image {
+	return r.images
+}
+
+func (r SplitTallResult) Log() {
+	r.logThreshold()
+	if len(r.images) > 1 {
+		log.Printf("[TALL] %v : %v pages\n", r.filename, len(r.images))
+	}
+}
+
+func (r SplitTallResult) Report(report *PageReport) {
+	r.reportThreshold(report)
+}
+
+// ----------------------------------------------------------------------------
+
+// SplitTallFilter cuts pages much taller than the device aspect ratio, such as
+// webtoon strips, into pages of the device aspect ratio so that they are not
+// shrunk to unreadable widths. Pages are cut at empty rows if possible.
+type SplitTallFilter struct {
+	autoThresholdFilter
+	option SplitTallOption
+}
+
+func NewSplitTallFilter(option SplitTallOption) *SplitTallFilter {
+	if option.TallRate == 0 {
+		option.TallRate = defaultTallRate
+	}
+	if option.MinPageRate == 0 {
+		option.MinPageRate = defaultTallMinPageRate
+	}
+
+	return &SplitTallFilter{
+		option:              option,
+		autoThresholdFilter: autoThresholdFilter{newAutoThreshold(option.AutoThreshold, option.LockThreshold)},
+	}
+}
+
+func init() {
+	RegisterFilter("splitTall", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewSplitTallOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewSplitTallFilter(*option), nil
+	})
+}
+
+// Implements Filter.Run()
+func (f SplitTallFilter) Run(s *FilterSource) (FilterResult, error) {
+	if f.threshold.enabled() {
+		f.option.Threshold = f.threshold.get(s.image)
+	}
+	threshold := thresholdResult{s.filename, f.threshold.enabled(), f.option.Threshold}
+
+	src := s.image
+	if src.Bounds().Min != (image.Point{}) {
+		src = cropImage(src, src.Bounds())
+	}
+	rects, err := f.pageRects(src, s.deviceWidth, s.deviceHeight)
+	if err != nil {
+		return nil, err
+	}
+	if len(rects) == 1 {
+		return SplitTallResult{threshold, []image.Image{s.image}}, nil
+	}
+
+	var images []image.Image
+	for _, rect := range rects {
+		images = append(images, cropImage(src, rect))
+	}
+	return SplitTallResult{threshold, images}, nil
+}
+
+// PageRects returns rectangles of the pages which Run cuts from the image,
+// from top to bottom. The image should have the origin at (0, 0).
+// The device size is used if width and height options are not set.
+// It lets webtoon strips end at the cut of the last page.
+func (f SplitTallFilter) PageRects(src image.Image, deviceWidth, deviceHeight int) ([]image.Rectangle, error) {
+	if f.threshold.enabled() {
+		f.option.Threshold = f.threshold.get(src)
+	}
+	return f.pageRects(src, deviceWidth, deviceHeight)
+}
+
+// pageRects returns rectangles of pages, or the bounds of the image if it is not tall.
+func (f SplitTallFilter) pageRects(src image.Image, deviceWidth, deviceHeight int) ([]image.Rectangle, error) {
+	width, height := f.option.Width, f.option.Height
+	if width == 0 || height == 0 {
+		width, height = deviceWidth, deviceHeight
+	}
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("splitTall needs width and height options or the device size")
+	}
+
+	bounds := src.Bounds()
+	pageHeight := Max(1, bounds.Dx()*height/width)
+	if float32(bounds.Dy()) <= float32(pageHeight)*f.option.TallRate {
+		return []image.Rectangle{bounds}, nil
+	}
+	return f.split(src, pageHeight), nil
+}
+
+// split returns rectangles of pages from top to bottom.
+// Each page is cut at the centre of the lowest line gap in the page,
+// clipped to the page height, or at the page height if there is no gap
+// below MinPageRate of the page. Empty lines are found like changeLineSpace.
+func (f SplitTallFilter) split(src image.Image, pageHeight int) []image.Rectangle {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	ranges := findLineRanges(src, uint32(f.option.Threshold), f.option.EmptyLineThreshold)
+
+	overlap := int(f.option.Overlap)
+	if f.option.Overlap < 1 {
+		overlap = int(float64(pageHeight) * f.option.Overlap)
+	}
+	minPage := Max(1, int(float32(pageHeight)*f.option.MinPageRate))
+	overlap = Min(overlap, minPage-1)
+
+	var rects []image.Rectangle
+	top := 0
+	for {
+		bottom := top + pageHeight
+		if bottom >= height {
+			rects = append(rects, image.Rect(0, top, width, height))
+			break
+		}
+		cut := bottom
+		for _, r := range ranges {
+			if !r.emptyLine || r.start >= bottom || r.end+1 < top+minPage {
+				continue
+			}
+			cut = Max(top+minPage, Min(bottom, (r.start+r.end+1)/2))
+		}
+		rects = append(rects, image.Rect(0, top, width, cut))
+		top = cut - overlap
+	}
+	return rects
+}
@@ -0,0 +1,71 @@
+package lecimg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// createTallPage draws 30 dots high text lines every 50 dots in a 100x1000 strip.
+func createTallPage() *image.RGBA {
+	img := CreateImage(100, 1000, color.White)
+	for y := 10; y+30 <= 1000; y += 50 {
+		FillRect(img, 10, y, 90, y+30, color.Black)
+	}
+	return img
+}
+
+func TestSplitTall(t *testing.T) {
+	s := NewFilterSource(createTallPage(), "filename", 0)
+	s.deviceWidth, s.deviceHeight = 200, 300
+
+	result := runTestFilterSource(t, NewSplitTallFilter(SplitTallOption{Threshold: 128}), s).(SplitTallResult)
+	pages := result.Imgs()
+	if len(pages) < 7 {
+		t.Fatalf("page count mismatch. pages=%v", len(pages))
+	}
+	total := 0
+	for i, page := range pages {
+		bounds := page.Bounds()
+		if bounds.Dx() != 100 || bounds.Dy() > 150 || bounds.Dy() < 75 {
+			t.Errorf("page %v size mismatch. actual=%v", i, bounds)
+		}
+		// pages are cut at line gaps
+		if isDark(page, 50, 0) || isDark(page, 50, bounds.Dy()-1) {
+			t.Errorf("page %v is cut in a text line", i)
+		}
+		total += bounds.Dy()
+	}
+	if total != 1000 {
+		t.Errorf("total height mismatch. expected=1000, actual=%v", total)
+	}
+}
+
+func TestSplitTallOverlap(t *testing.T) {
+	src := createTallPage()
+	result := runTestFilter(t, NewSplitTallFilter(SplitTallOption{Threshold: 128, Width: 200, Height: 300, Overlap: 20}), src).(SplitTallResult)
+	pages := result.Imgs()
+	if len(pages) < 2 {
+		t.Fatalf("page count mismatch. pages=%v", len(pages))
+	}
+	// the next page repeats the last 20 rows of the previous page
+	first, second := pages[0], pages[1]
+	height := first.Bounds().Dy()
+	for y := 0; y < 20; y++ {
+		if isDark(first, 50, height-20+y) != isDark(second, 50, y) {
+			t.Fatalf("overlap mismatch at %v", y)
+		}
+	}
+}
+
+func TestSplitTallShortPage(t *testing.T) {
+	src := CreateImage(100, 160, color.White)
+	result := runTestFilter(t, NewSplitTallFilter(SplitTallOption{Threshold: 128, Width: 200, Height: 300}), src).(SplitTallResult)
+	if len(result.Imgs()) != 1 || result.Img() != image.Image(src) {
+		t.Errorf("page within the tall rate should not be split")
+	}
+
+	if _, err := NewSplitTallFilter(SplitTallOption{}).Run(NewFilterSource(src, "filename", 0)); err == nil {
+		t.Errorf("splitTall without page size should fail")
+	}
+}
@@ -0,0 +1,209 @@
+package lecimg
+
+import (
+	"image"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ThresholdAuto is the value of "threshold" option which selects
+// the threshold from the histogram of each page.
+const ThresholdAuto = "auto"
+
+// parseAutoThreshold removes "threshold: auto" from filter options
+// so that the rest can be decoded into the option struct.
+// It returns true if auto threshold is requested.
+func parseAutoThreshold(m map[string]interface{}) (map[string]interface{}, bool) {
+	for key, value := range m {
+		if !strings.EqualFold(key, "threshold") {
+			continue
+		}
+		if s, ok := value.(string); !ok || !strings.EqualFold(s, ThresholdAuto) {
+			return m, false
+		}
+
+		options := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			if k != key {
+				options[k] = v
+			}
+		}
+		return options, true
+	}
+	return m, false
+}
+
+// OtsuThreshold returns the brightness threshold (0~255) which separates
+// dark dots from the background by Otsu's method.
+// Dots darker than the threshold belong to the foreground.
+// It returns 0 if the image has only one brightness level.
+func OtsuThreshold(src image.Image) uint8 {
+	bounds := src.Bounds()
+	histogram := brightnessHistogram(src)
+
+	total := bounds.Dx() * bounds.Dy()
+	sum := 0.0
+	for i, count := range histogram {
+		sum += float64(i * count)
+	}
+
+	// maximize between-class variance.
+	// the middle of equally good thresholds is used for clean separations.
+	var best float64
+	var first, last int
+	var weight0 int
+	var sum0 float64
+	for t := 0; t < 255; t++ {
+		weight0 += histogram[t]
+		if weight0 == 0 {
+			continue
+		}
+		weight1 := total - weight0
+		if weight1 == 0 {
+			break
+		}
+		sum0 += float64(t * histogram[t])
+		mean0 := sum0 / float64(weight0)
+		mean1 := (sum - sum0) / float64(weight1)
+		variance := float64(weight0) * float64(weight1) * (mean0 - mean1) * (mean0 - mean1)
+		if variance > best {
+			best = variance
+			first, last = t+1, t+1
+		} else if variance == best && best > 0 {
+			last = t + 1
+		}
+	}
+	return uint8((first + last) / 2)
+}
+
+// brightnessHistogram returns dot counts of each brightness (0~255).
+func brightnessHistogram(src image.Image) [256]int {
+	bounds := src.Bounds()
+
+	var histogram [256]int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := src.At(x, y).RGBA()
+			histogram[getBrightness(r, g, b)>>8]++
+		}
+	}
+	return histogram
+}
+
+// autoThreshold selects the threshold of pages by Otsu's method.
+// If lock is true, the median of thresholds found in the analysis pass
+// is used for every page of the book.
+// It is safe for concurrent use.
+type autoThreshold struct {
+	lock     bool
+	mutex    sync.Mutex
+	values   []int
+	analyzed bool // locked is valid
+	ended    bool // endAnalysis is called
+	locked   uint8
+}
+
+func newAutoThreshold(auto, lock bool) *autoThreshold {
+	if !auto {
+		return nil
+	}
+	return &autoThreshold{lock: lock}
+}
+
+func (t *autoThreshold) enabled() bool {
+	return t != nil
+}
+
+func (t *autoThreshold) needsAnalysis() bool {
+	return t != nil && t.lock
+}
+
+// add finds the threshold of a page in the analysis pass.
+func (t *autoThreshold) add(src image.Image) uint8 {
+	threshold := OtsuThreshold(src)
+	if threshold > 0 {
+		t.mutex.Lock()
+		t.values = append(t.values, int(threshold))
+		t.mutex.Unlock()
+	}
+	return threshold
+}
+
+// endAnalysis locks the threshold of the book.
+func (t *autoThreshold) endAnalysis() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.ended = true
+	if len(t.values) == 0 {
+		return
+	}
+	sort.Ints(t.values)
+	t.locked = uint8(t.values[len(t.values)/2])
+	t.analyzed = true
+	log.Printf("[THRESHOLD] book threshold : %v (%v pages)\n", t.locked, len(t.values))
+}
+
+// analysisEnded returns true if the analysis pass of the threshold is finished.
+func (t *autoThreshold) analysisEnded() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.ended
+}
+
+// get returns the threshold of the page.
+func (t *autoThreshold) get(src image.Image) uint8 {
+	if t.lock {
+		t.mutex.Lock()
+		analyzed, locked := t.analyzed, t.locked
+		t.mutex.Unlock()
+		if analyzed {
+			return locked
+		}
+	}
+	return OtsuThreshold(src)
+}
+
+// autoThresholdFilter implements BookFilter for filters which analyze pages
+// only to lock the auto threshold. Such filters embed it.
+type autoThresholdFilter struct {
+	threshold *autoThreshold
+}
+
+// Implements BookFilter.NeedsAnalysis()
+func (f autoThresholdFilter) NeedsAnalysis() bool {
+	return f.threshold.needsAnalysis()
+}
+
+// Implements BookFilter.Analyze()
+func (f autoThresholdFilter) Analyze(s *FilterSource) error {
+	f.threshold.add(s.image)
+	return nil
+}
+
+// Implements BookFilter.EndAnalysis()
+func (f autoThresholdFilter) EndAnalysis() {
+	f.threshold.endAnalysis()
+}
+
+// thresholdResult is embedded in results of filters which support auto threshold.
+type thresholdResult struct {
+	filename  string
+	auto      bool
+	threshold uint8
+}
+
+func (r thresholdResult) logThreshold() {
+	if r.auto {
+		log.Printf("[THRESHOLD] %v : %v\n", r.filename, r.threshold)
+	}
+}
+
+func (r thresholdResult) reportThreshold(report *PageReport) {
+	if r.auto {
+		threshold := int(r.threshold)
+		report.Threshold = &threshold
+	}
+}
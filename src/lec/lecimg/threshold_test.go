@@ -0,0 +1,77 @@
+package lecimg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOtsuThreshold(t *testing.T) {
+	for _, c := range []struct{ background, text uint8 }{
+		{240, 40},
+		{170, 60}, // grey paper
+	} {
+		img := CreateImage(100, 100, color.Gray{c.background})
+		FillRect(img, 20, 20, 80, 40, color.Gray{c.text})
+
+		threshold := OtsuThreshold(img)
+		if threshold <= c.text || threshold > c.background {
+			t.Errorf("threshold mismatch. background=%v, text=%v, actual=%v", c.background, c.text, threshold)
+		}
+	}
+
+	if threshold := OtsuThreshold(CreateImage(10, 10, color.White)); threshold != 0 {
+		t.Errorf("blank page threshold should be 0. actual=%v", threshold)
+	}
+}
+
+func TestAutoThresholdOption(t *testing.T) {
+	option, err := NewAutoCropOption(map[string]interface{}{"threshold": "Auto", "minRatio": 1.0})
+	if err != nil {
+		t.Fatalf("failed to parse option : %v", err)
+	}
+	if !option.AutoThreshold || option.MinRatio != 1.0 {
+		t.Errorf("option mismatch. actual=%+v", option)
+	}
+
+	if _, err := NewDeskewOption(map[string]interface{}{"threshold": "dark"}); err == nil {
+		t.Errorf("error expected for invalid threshold")
+	}
+}
+
+func newThresholdPage(background uint8) image.Image {
+	img := CreateImage(100, 100, color.Gray{background})
+	FillRect(img, 20, 20, 80, 40, color.Black)
+	return img
+}
+
+func TestAutoThresholdLock(t *testing.T) {
+	pipeline := NewPipeline(AbortOnError)
+	pipeline.AddFilter("deskew", NewDeskewFilter(DeskewOption{
+		AutoThreshold: true,
+		LockThreshold: true,
+	}), nil)
+	if !pipeline.NeedsAnalysis() {
+		t.Fatalf("locked threshold needs analysis")
+	}
+
+	pages := []uint8{200, 220, 240}
+	for i, background := range pages {
+		pipeline.Analyze(newThresholdPage(background), "filename", i)
+	}
+	pipeline.EndAnalysis()
+
+	for i, background := range pages {
+		if _, err := pipeline.Run(newThresholdPage(background), "filename", i); err != nil {
+			t.Fatalf("pipeline failed : %v", err)
+		}
+	}
+
+	// median of page thresholds
+	expected := int(OtsuThreshold(newThresholdPage(220)))
+	for _, page := range pipeline.Report().Pages() {
+		if page.Threshold == nil || *page.Threshold != expected {
+			t.Errorf("threshold should be locked. index=%v, expected=%v, actual=%v", page.Index, expected, page.Threshold)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package lecimg
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/disintegration/gift"
+	"github.com/mitchellh/mapstructure"
+)
+
+// auto levels modes
+const (
+	AutoLevelsNone = ""
+	AutoLevelsPage = "page"
+	AutoLevelsBook = "book"
+)
+
+const defaultAutoLevelsClip = 0.005
+
+type ToneOption struct {
+	Grayscale      bool    // converts to single channel gray image
+	BlackPoint     uint8   // brightness mapped to black (levels)
+	WhitePoint     uint8   // brightness mapped to white (levels, default: 255)
+	Gamma          float32 // gamma correction. less than 1 darkens mid-greys (default: 1)
+	Contrast       float32 // S-curve contrast factor (-10~10). positive increases contrast
+	AutoLevels     string  // "" : off, "page" : levels per page, "book" : levels per book
+	AutoLevelsClip float32 // rate of dots clipped at each end of histogram for auto levels (default: 0.005)
+}
+
+func NewToneOption(m map[string]interface{}) (*ToneOption, error) {
+	option := ToneOption{}
+
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+
+	switch option.AutoLevels {
+	case AutoLevelsNone, AutoLevelsPage, AutoLevelsBook:
+	default:
+		return nil, fmt.Errorf("invalid autoLevels : %v", option.AutoLevels)
+	}
+	if option.Gamma < 0 {
+		return nil, fmt.Errorf("invalid gamma : %v", option.Gamma)
+	}
+	if option.AutoLevelsClip < 0 || option.AutoLevelsClip >= 0.5 {
+		return nil, fmt.Errorf("invalid autoLevelsClip : %v", option.AutoLevelsClip)
+	}
+	if option.WhitePoint != 0 && option.WhitePoint <= option.BlackPoint {
+		return nil, fmt.Errorf("whitePoint should be greater than blackPoint : %v, %v",
+			option.WhitePoint, option.BlackPoint)
+	}
+
+	return &option, nil
+}
+
+type ToneResult struct {
+	image    image.Image
+	filename string
+	auto     bool
+	black    uint8
+	white    uint8
+}
+
+func (r ToneResult) Img() image.Image {
+	return r.image
+}
+
+func (r ToneResult) Log() {
+	if r.auto {
+		log.Printf("[TONE] %v : levels %v-%v\n", r.filename, r.black, r.white)
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// ToneFilter adjusts levels, gamma and contrast of a page.
+// Grayscale pages are *image.Gray so that writers store a single channel.
+type ToneFilter struct {
+	option ToneOption
+	levels *bookLevels
+}
+
+func NewToneFilter(option ToneOption) *ToneFilter {
+	if option.WhitePoint == 0 {
+		option.WhitePoint = 255
+	}
+	if option.Gamma == 0 {
+		option.Gamma = 1
+	}
+	if option.AutoLevelsClip == 0 {
+		option.AutoLevelsClip = defaultAutoLevelsClip
+	}
+
+	f := ToneFilter{option: option}
+	if option.AutoLevels == AutoLevelsBook {
+		f.levels = &bookLevels{}
+	}
+	return &f
+}
+
+func init() {
+	RegisterFilter("tone", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewToneOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewToneFilter(*option), nil
+	})
+}
+
+// Implements Filter.Run()
+func (f ToneFilter) Run(s *FilterSource) (FilterResult, error) {
+	black, white := f.option.BlackPoint, f.option.WhitePoint
+	auto := f.option.AutoLevels != AutoLevelsNone
+	if auto {
+		if bookBlack, bookWhite, ok := f.levels.get(); ok {
+			black, white = bookBlack, bookWhite
+		} else {
+			black, white = f.findLevels(s.image)
+		}
+	}
+
+	return ToneResult{f.apply(s.image, black, white), s.filename, auto, black, white}, nil
+}
+
+// Implements BookFilter.NeedsAnalysis()
+func (f ToneFilter) NeedsAnalysis() bool {
+	return f.levels != nil
+}
+
+// Implements BookFilter.Analyze()
+func (f ToneFilter) Analyze(s *FilterSource) error {
+	black, white := f.findLevels(s.image)
+	if black < white {
+		f.levels.add(black, white)
+	}
+	return nil
+}
+
+// Implements BookFilter.EndAnalysis()
+func (f ToneFilter) EndAnalysis() {
+	f.levels.end()
+}
+
+// findLevels returns black and white points which clip AutoLevelsClip
+// of dots at both ends of the histogram.
+// It returns 0 and 255 for blank pages.
+func (f ToneFilter) findLevels(src image.Image) (uint8, uint8) {
+	histogram := brightnessHistogram(src)
+	bounds := src.Bounds()
+	clip := int(float32(bounds.Dx()*bounds.Dy()) * f.option.AutoLevelsClip)
+
+	black, count := 0, 0
+	for ; black < 255; black++ {
+		if count += histogram[black]; count > clip {
+			break
+		}
+	}
+	white, count := 255, 0
+	for ; white > 0; white-- {
+		if count += histogram[white]; count > clip {
+			break
+		}
+	}
+
+	if black >= white {
+		return 0, 255
+	}
+	return uint8(black), uint8(white)
+}
+
+func (f ToneFilter) apply(src image.Image, black, white uint8) image.Image {
+	var filters []gift.Filter
+	if f.option.Grayscale {
+		filters = append(filters, gift.Grayscale())
+	}
+	if black > 0 || white < 255 {
+		filters = append(filters, levelsFilter(black, white))
+	}
+	if f.option.Gamma != 1 {
+		filters = append(filters, gift.Gamma(f.option.Gamma))
+	}
+	if f.option.Contrast != 0 {
+		filters = append(filters, gift.Sigmoid(0.5, f.option.Contrast))
+	}
+
+	g := gift.New(filters...)
+	if f.option.Grayscale {
+		dest := image.NewGray(g.Bounds(src.Bounds()))
+		g.Draw(dest, src)
+		return dest
+	}
+	if len(filters) == 0 {
+		return src
+	}
+	dest := image.NewRGBA(g.Bounds(src.Bounds()))
+	g.Draw(dest, src)
+	return dest
+}
+
+// levelsFilter maps black point to 0 and white point to 1 linearly.
+func levelsFilter(black, white uint8) gift.Filter {
+	low := float32(black) / 255
+	scale := 255 / float32(white-black)
+	level := func(v float32) float32 {
+		v = (v - low) * scale
+		if v < 0 {
+			return 0
+		} else if v > 1 {
+			return 1
+		}
+		return v
+	}
+	return gift.ColorFunc(func(r, g, b, a float32) (float32, float32, float32, float32) {
+		return level(r), level(g), level(b), a
+	})
+}
+
+// ----------------------------------------------------------------------------
+
+// bookLevels collects levels of pages in the analysis pass and provides
+// the median levels for the whole book.
+// It is safe for concurrent use.
+type bookLevels struct {
+	mutex    sync.Mutex
+	blacks   []int
+	whites   []int
+	analyzed bool
+	black    uint8
+	white    uint8
+}
+
+func (l *bookLevels) add(black, white uint8) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.blacks = append(l.blacks, int(black))
+	l.whites = append(l.whites, int(white))
+}
+
+// end finishes the analysis pass and logs the levels.
+func (l *bookLevels) end() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(l.blacks) == 0 {
+		return
+	}
+	sort.Ints(l.blacks)
+	sort.Ints(l.whites)
+	l.black = uint8(l.blacks[len(l.blacks)/2])
+	l.white = uint8(l.whites[len(l.whites)/2])
+	if l.black >= l.white {
+		l.black, l.white = 0, 255
+	}
+	l.analyzed = true
+	log.Printf("[TONE] book levels : %v-%v (%v pages)\n", l.black, l.white, len(l.blacks))
+}
+
+// get returns the book levels. It returns false before the analysis pass ends.
+func (l *bookLevels) get() (uint8, uint8, bool) {
+	if l == nil {
+		return 0, 0, false
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.black, l.white, l.analyzed
+}
@@ -0,0 +1,82 @@
+package lecimg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestToneGrayscale(t *testing.T) {
+	img := CreateImage(10, 10, color.RGBA{200, 100, 50, 255})
+	if _, ok := runTestFilter(t, NewToneFilter(ToneOption{Grayscale: true}), img).Img().(*image.Gray); !ok {
+		t.Errorf("gray image expected")
+	}
+}
+
+func TestToneLevels(t *testing.T) {
+	img := CreateImage(30, 10, color.Gray{50})
+	FillRect(img, 10, 0, 20, 10, color.Gray{125})
+	FillRect(img, 20, 0, 30, 10, color.Gray{200})
+
+	dest := runTestFilter(t, NewToneFilter(ToneOption{BlackPoint: 50, WhitePoint: 200}), img).Img()
+	for x, expected := range map[int]uint8{5: 0, 25: 255} {
+		if v := grayAt(dest, x, 5); v != expected {
+			t.Errorf("brightness mismatch. x=%v, expected=%v, actual=%v", x, expected, v)
+		}
+	}
+	if v := grayAt(dest, 15, 5); v < 120 || v > 135 {
+		t.Errorf("mid-grey should stay in the middle. actual=%v", v)
+	}
+}
+
+func TestToneGammaContrast(t *testing.T) {
+	img := CreateImage(10, 10, color.Gray{160})
+
+	if v := grayAt(runTestFilter(t, NewToneFilter(ToneOption{Gamma: 0.7}), img).Img(), 5, 5); v >= 160 {
+		t.Errorf("gamma should darken mid-grey. actual=%v", v)
+	}
+	if v := grayAt(runTestFilter(t, NewToneFilter(ToneOption{Contrast: 5}), img).Img(), 5, 5); v <= 160 {
+		t.Errorf("contrast should lighten light grey. actual=%v", v)
+	}
+}
+
+func TestToneAutoLevels(t *testing.T) {
+	img := CreateImage(100, 100, color.Gray{220})
+	FillRect(img, 20, 20, 80, 40, color.Gray{80})
+
+	dest := runTestFilter(t, NewToneFilter(ToneOption{AutoLevels: AutoLevelsPage}), img).Img()
+	if v := grayAt(dest, 5, 5); v != 255 {
+		t.Errorf("background should be white. actual=%v", v)
+	}
+	if v := grayAt(dest, 30, 30); v != 0 {
+		t.Errorf("text should be black. actual=%v", v)
+	}
+}
+
+func TestToneAutoLevelsBook(t *testing.T) {
+	pipeline := NewPipeline(AbortOnError)
+	pipeline.AddFilter("tone", NewToneFilter(ToneOption{AutoLevels: AutoLevelsBook}), nil)
+
+	pages := []uint8{200, 220, 240}
+	newPage := func(background uint8) image.Image {
+		img := CreateImage(100, 100, color.Gray{background})
+		FillRect(img, 20, 20, 80, 40, color.Gray{80})
+		return img
+	}
+	for i, background := range pages {
+		pipeline.Analyze(newPage(background), "filename", i)
+	}
+	pipeline.EndAnalysis()
+
+	// book white point is 220. the darker page keeps its grey background.
+	for i, background := range pages {
+		dest, err := pipeline.Run(newPage(background), "filename", i)
+		if err != nil {
+			t.Fatalf("pipeline failed : %v", err)
+		}
+		v := grayAt(dest, 5, 5)
+		if (background >= 220) != (v == 255) {
+			t.Errorf("book levels mismatch. background=%v, actual=%v", background, v)
+		}
+	}
+}
@@ -49,10 +49,20 @@ func NewWatermarkFilter(option WatermarkOption) *WatermarkFilter {
 	return &WatermarkFilter{option: option}
 }
 
+func init() {
+	RegisterFilter("watermark", func(m map[string]interface{}) (Filter, error) {
+		option, err := NewWatermarkOption(m)
+		if err != nil {
+			return nil, err
+		}
+		return NewWatermarkFilter(*option), nil
+	})
+}
+
 // Implements Filter.Run()
-func (f WatermarkFilter) Run(s *FilterSource) FilterResult {
+func (f WatermarkFilter) Run(s *FilterSource) (FilterResult, error) {
 	img := f.run(s.image)
-	return WatermarkResult{img}
+	return WatermarkResult{img}, nil
 }
 
 // actual watermark implementation
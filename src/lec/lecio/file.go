@@ -1,6 +1,7 @@
 package lecio
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -30,6 +31,23 @@ func GetBaseWithoutExt(filename string) string {
 	return base[:len(base)-len(filepath.Ext(filename))]
 }
 
+// GetPageFilename returns the filename of a page split from a source file.
+// It returns filename itself if there is only one page.
+// Otherwise a 1-based page number is appended to the base name, e.g. "p01-002.jpg",
+// which is sorted right after the pages of preceding source files.
+// The page number has 3 digits, or more if pageCount needs them to keep the order.
+func GetPageFilename(filename string, page, pageCount int) string {
+	if pageCount <= 1 {
+		return filename
+	}
+	digits := len(fmt.Sprint(pageCount))
+	if digits < 3 {
+		digits = 3
+	}
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%v-%0*d%v", filename[:len(filename)-len(ext)], digits, page+1, ext)
+}
+
 func Exists(path string) (bool, error) {
 	_, err := os.Stat(path)
 	if err == nil {
@@ -47,19 +47,36 @@ func CreateImagePdf(srcDir string, destDir string, filename string, opt PdfOptio
 			H: toPdfPoint(height),
 		}
 
+		// quantized pages are embedded without loss
+		lossless := lecimg.IsLosslessImage(img)
+
 		// show edge point
 		if opt.ShowEdgePoint {
-			rgba := image.NewRGBA(image.Rect(0, 0, width, height))
-			draw.Draw(rgba, imageBounds, img, imageBounds.Min, draw.Src)
-
-			rgba.Set(0, 0, color.Black)
-			rgba.Set(width-1, 0, color.Black)
-			rgba.Set(0, height-1, color.Black)
-			rgba.Set(width-1, height-1, color.Black)
-			img = rgba
+			// gray and paletted pages keep their colors
+			var dest draw.Image
+			switch src := img.(type) {
+			case *image.Gray, *lecimg.QuantizedGray:
+				dest = image.NewGray(image.Rect(0, 0, width, height))
+			case *image.Paletted:
+				dest = image.NewPaletted(image.Rect(0, 0, width, height), src.Palette)
+			default:
+				dest = image.NewRGBA(image.Rect(0, 0, width, height))
+			}
+			draw.Draw(dest, dest.Bounds(), img, imageBounds.Min, draw.Src)
+
+			dest.Set(0, 0, color.Black)
+			dest.Set(width-1, 0, color.Black)
+			dest.Set(0, height-1, color.Black)
+			dest.Set(width-1, height-1, color.Black)
+			img = dest
 		}
 
-		bytes, err := lecimg.ToJpegBytes(img, opt.Quality)
+		var bytes []byte
+		if lossless {
+			bytes, err = lecimg.ToPngBytes(img)
+		} else {
+			bytes, err = lecimg.ToJpegBytes(img, opt.Quality)
+		}
 		if err != nil {
 			return err
 		}
@@ -93,7 +93,7 @@ func Unzip(src, dest string, callback UnzipCallback) error {
 			}
 
 			if callback != nil {
-				callback(dest, filepath.Base(f.Name()), index)
+				callback(filepath.Dir(destPath), filepath.Base(destPath), index)
 			}
 		}
 		return nil